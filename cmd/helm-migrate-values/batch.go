@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"github.com/octopusdeploylabs/helm-migrate-values/internal"
+	"github.com/octopusdeploylabs/helm-migrate-values/pkg"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/release"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"text/tabwriter"
+)
+
+// The status of each release in a batch
+const (
+	migratedStatus  = "migrated"
+	appliedStatus   = "applied"
+	unchangedStatus = "no migration required"
+	failedStatus    = "failed"
+)
+
+type batchResult struct {
+	release *release.Release
+	status  string
+	detail  string
+	// steps are the migrations applied to the release's values
+	steps []pkg.MigrationStep
+}
+
+// runBatch migrates every deployed release of the target chart, using a bounded number of workers. A release that
+// fails to migrate does not stop the batch, and each completed release is recorded in the state file, if there is one.
+func runBatch(out io.Writer, errOut io.Writer, target *targetChart, listAction *action.List, historyAction *action.History, upgradeAction *action.Upgrade, settings *cli.EnvSettings, caps func() *chartutil.Capabilities, opts *runOptions, log pkg.Logger) error {
+	releases, err := internal.ListReleasesForChart(target.chart.Name(), listAction, historyAction, opts.allowPending, log)
+	if err != nil {
+		return err
+	}
+
+	if len(releases) == 0 {
+		log.Information("No deployed releases use chart %s", target.chart.Name())
+		return nil
+	}
+
+	// Charts with the same values schema version can still be different, so the state is for the chart version
+	state, err := internal.LoadBatchState(opts.stateFile, target.chart.Name(), target.chart.Metadata.Version)
+	if err != nil {
+		return err
+	}
+
+	log.Information("Migrating %d releases of chart %s to version %s", len(releases), target.chart.Name(), target.version)
+
+	results := make([]batchResult, len(releases))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(opts.parallelism, len(releases)) {
+		// Rendering and upgrading process the chart's dependencies in place, so each worker uses its own copy
+		workerTarget, err := target.reload()
+		if err != nil {
+			close(jobs)
+			wg.Wait()
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = migrateBatchRelease(releases[i], workerTarget, state, upgradeAction, settings, caps, opts, log)
+			}
+		}()
+	}
+
+	for i := range releases {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var steps []pkg.MigrationStep
+	for _, r := range results {
+		steps = append(steps, r.steps...)
+	}
+	writeMigrationNotes(errOut, steps)
+
+	return writeBatchSummary(out, results)
+}
+
+// reload loads a new copy of the target chart
+func (t *targetChart) reload() (*targetChart, error) {
+	chrt, err := loader.Load(t.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart: %w", err)
+	}
+
+	return &targetChart{dir: t.dir, chart: chrt, version: t.version}, nil
+}
+
+func migrateBatchRelease(rel *release.Release, target *targetChart, state *internal.BatchState, upgradeFlags *action.Upgrade, settings *cli.EnvSettings, caps func() *chartutil.Capabilities, opts *runOptions, log pkg.Logger) batchResult {
+	key := rel.Namespace + "/" + rel.Name
+	if previous, ok := state.Get(key); ok {
+		log.Debug("Skipping release %s, which was %s by a previous run", key, previous.Status)
+		return batchResult{release: rel, status: "previously " + previous.Status, detail: previous.OutputFile}
+	}
+
+	// A dry run does not change the release, so it is not recorded as complete
+	dryRun := opts.apply && internal.IsDryRun(upgradeFlags)
+
+	var steps []pkg.MigrationStep
+	status, outputFile, err := func() (string, string, error) {
+		if len(rel.Config) == 0 {
+			return unchangedStatus, "", nil
+		}
+
+		migration, err := migrateRelease(rel, target, caps, opts, log)
+		if err != nil {
+			return "", "", err
+		}
+
+		migratedConfig := migration.values()
+		if len(migratedConfig) == 0 {
+			return unchangedStatus, "", nil
+		}
+		steps = migration.result.Steps
+
+		var outputFile string
+		if opts.outputDir != "" {
+			migratedValues, err := formatValues(migratedConfig, nil, opts.output)
+			if err != nil {
+				return "", "", err
+			}
+
+			outputFile = filepath.Join(opts.outputDir, rel.Namespace, rel.Name+outputExtensions[opts.output])
+			if err = os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+				return "", "", fmt.Errorf("error creating output directory: %w", err)
+			}
+			if err = writeOutputValues(nil, outputFile, migratedValues); err != nil {
+				return "", "", err
+			}
+		}
+
+		if !opts.apply {
+			return migratedStatus, outputFile, nil
+		}
+
+		upgradeAction, err := internal.NewUpgradeInNamespace(settings, rel.Namespace, upgradeFlags, log)
+		if err != nil {
+			return "", "", err
+		}
+		if err = applyMigratedValues(rel.Name, target, migratedConfig, upgradeAction, log); err != nil {
+			return "", "", err
+		}
+		if dryRun {
+			return migratedStatus, outputFile, nil
+		}
+		return appliedStatus, outputFile, nil
+	}()
+
+	if err != nil {
+		log.Warning("Failed to migrate release %s: %v", key, err)
+		return batchResult{release: rel, status: failedStatus, detail: err.Error()}
+	}
+
+	if !dryRun {
+		if err = state.Complete(key, internal.BatchReleaseState{Status: status, OutputFile: outputFile}); err != nil {
+			log.Warning("%v", err)
+		}
+	}
+
+	return batchResult{release: rel, status: status, detail: outputFile, steps: steps}
+}
+
+func writeBatchSummary(out io.Writer, results []batchResult) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAMESPACE\tRELEASE\tCHART VERSION\tSTATUS\tDETAILS")
+
+	failed := 0
+	for _, r := range results {
+		if r.status == failedStatus {
+			failed++
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.release.Namespace, r.release.Name, r.release.Chart.Metadata.Version, r.status, r.detail)
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error writing batch summary: %w", err)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d releases failed to migrate", failed, len(results))
+	}
+	return nil
+}
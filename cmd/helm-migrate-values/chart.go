@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"github.com/octopusdeploylabs/helm-migrate-values/internal"
+	"github.com/octopusdeploylabs/helm-migrate-values/pkg"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"os"
+)
+
+// locateAndLoadChart locates the chart, downloading it if required, and loads it. The returned directory is the chart's
+// root, which the migration directory is relative to. The cleanup function must be called once the chart directory is
+// no longer needed.
+func locateAndLoadChart(chartRef string, installAction *action.Install, settings *cli.EnvSettings, log pkg.Logger) (string, *chart.Chart, func(), error) {
+	chartDir, cleanupDirectory, err := internal.LocateChart(chartRef, installAction, settings, log)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to download chart: %w", err)
+	}
+
+	cleanup := func() {
+		if cleanupDirectory {
+			log.Debug("Cleaning up extracted chart at %s", *chartDir)
+			if err := os.RemoveAll(*chartDir); err != nil {
+				log.Warning("failed to cleanup extracted chart: %v", err)
+			}
+		}
+	}
+
+	chartRoot, err := internal.ChartRoot(*chartDir)
+	if err != nil {
+		cleanup()
+		return "", nil, nil, fmt.Errorf("failed to find chart: %w", err)
+	}
+
+	chrt, err := loader.Load(chartRoot)
+	if err != nil {
+		cleanup()
+		return "", nil, nil, fmt.Errorf("failed to load chart: %w", err)
+	}
+
+	return chartRoot, chrt, cleanup, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/octopusdeploylabs/helm-migrate-values/pkg"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"strings"
+)
+
+// writeDiff writes a unified diff of the values followed by a summary of the changes. Colours are only used when out
+// is a terminal and NO_COLOR is not set.
+func writeDiff(out io.Writer, from, to map[string]interface{}, fromName, toName string) error {
+	unified, err := pkg.UnifiedDiff(from, to, fromName, toName)
+	if err != nil {
+		return err
+	}
+
+	c := diffColorizer{enabled: isColorTerminal(out)}
+	var sb strings.Builder
+	sb.WriteString(c.diff(unified))
+	if unified != "" {
+		sb.WriteString("\n")
+	}
+	sb.WriteString(c.sprint(color.Bold, "Summary of changes:"))
+	sb.WriteString("\n")
+	sb.WriteString(c.summary(pkg.DiffValues(from, to).String()))
+
+	if _, err = fmt.Fprint(out, sb.String()); err != nil {
+		return fmt.Errorf("error writing values diff: %w", err)
+	}
+	return nil
+}
+
+// isColorTerminal reports whether colours can be written to the writer, which is the case for a terminal when NO_COLOR
+// is not set. Colours are decided by the writer rather than standard output, so that a diff written to a file or buffer
+// never contains escape codes.
+func isColorTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// diffColorizer colours the lines of a diff, if enabled
+type diffColorizer struct {
+	enabled bool
+}
+
+func (c diffColorizer) sprint(attribute color.Attribute, s string) string {
+	col := color.New(attribute)
+	if c.enabled {
+		col.EnableColor()
+	} else {
+		col.DisableColor()
+	}
+	return col.Sprint(s)
+}
+
+func (c diffColorizer) diff(diff string) string {
+	lines := strings.SplitAfter(diff, "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "---"), strings.HasPrefix(line, "+++"):
+			lines[i] = c.sprint(color.Bold, line)
+		case strings.HasPrefix(line, "@@"):
+			lines[i] = c.sprint(color.FgCyan, line)
+		case strings.HasPrefix(line, "-"):
+			lines[i] = c.sprint(color.FgRed, line)
+		case strings.HasPrefix(line, "+"):
+			lines[i] = c.sprint(color.FgGreen, line)
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+func (c diffColorizer) summary(summary string) string {
+	lines := strings.SplitAfter(summary, "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "added:"):
+			lines[i] = c.sprint(color.FgGreen, line)
+		case strings.HasPrefix(line, "removed:"):
+			lines[i] = c.sprint(color.FgRed, line)
+		case strings.HasPrefix(line, "changed:"):
+			lines[i] = c.sprint(color.FgYellow, line)
+		case strings.HasPrefix(line, "moved:"):
+			lines[i] = c.sprint(color.FgCyan, line)
+		}
+	}
+	return strings.Join(lines, "")
+}
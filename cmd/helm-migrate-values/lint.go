@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/octopusdeploylabs/helm-migrate-values/internal"
+	"github.com/octopusdeploylabs/helm-migrate-values/pkg"
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/cli"
+	"io"
+	"maps"
+	"path"
+	"path/filepath"
+	"slices"
+)
+
+const lintCmdDescription = `Check the migrations of a chart for problems, without applying them.
+
+The command reports:
+	- migration files, and the _helpers.tpl partials, that fail to parse, using the same functions as when they are applied
+	- files in the migration directory that do not match the migration naming pattern, and are ignored
+	- multiple migration files for the same version
+	- gaps in the major versions of the migrations (or minor versions of 0.x charts)
+	- down migrations without a matching up migration
+	- a highest migration version that is not for the chart's current major version, or is greater than the chart's version
+	- migration test fixtures that cannot be loaded
+
+Use --format json or --format sarif for machine-readable results, e.g. to annotate pull requests in CI. The command
+returns an error if any errors are found, or with --strict, if any warnings are found.
+`
+
+const (
+	textLintFormat  = "text"
+	jsonLintFormat  = "json"
+	sarifLintFormat = "sarif"
+)
+
+func newLintCmd(settings *cli.EnvSettings, out io.Writer, installAction *action.Install, opts *runOptions, log pkg.Logger) *cobra.Command {
+	var format string
+	var strict bool
+
+	cmd := &cobra.Command{
+		Use:          "lint [CHART] [flags]",
+		Short:        "check a chart's migrations for problems",
+		Long:         lintCmdDescription,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !slices.Contains([]string{textLintFormat, jsonLintFormat, sarifLintFormat}, format) {
+				return fmt.Errorf("unknown format '%s', expected %s, %s or %s", format, textLintFormat, jsonLintFormat, sarifLintFormat)
+			}
+
+			chartDir, chrt, cleanup, err := locateAndLoadChart(args[0], installAction, settings, log)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			chartVer, err := pkg.SchemaVersion(chrt)
+			if err != nil {
+				return err
+			}
+
+			issues, err := pkg.LintMigrations(internal.MigrationDir(chartDir, opts.migrationDir), chartVer)
+			if err != nil {
+				return err
+			}
+
+			if issues == nil {
+				issues = []pkg.LintIssue{}
+			}
+
+			switch format {
+			case jsonLintFormat:
+				err = writeJSON(out, issues)
+			case sarifLintFormat:
+				err = writeJSON(out, newSarifLog(issues, opts.migrationDir))
+			default:
+				err = writeLintIssues(out, issues)
+			}
+			if err != nil {
+				return err
+			}
+
+			errorCount, warningCount := countLintIssues(issues)
+			if errorCount > 0 || (strict && warningCount > 0) {
+				return fmt.Errorf("linting failed with %d error(s) and %d warning(s)", errorCount, warningCount)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", textLintFormat, "The format of the results: text, json or sarif.")
+	cmd.Flags().BoolVar(&strict, "strict", false, "Fail if any warnings are found, as well as errors.")
+
+	return cmd
+}
+
+func countLintIssues(issues []pkg.LintIssue) (int, int) {
+	errorCount, warningCount := 0, 0
+	for _, issue := range issues {
+		if issue.Severity == pkg.LintError {
+			errorCount++
+		} else {
+			warningCount++
+		}
+	}
+	return errorCount, warningCount
+}
+
+func writeLintIssues(out io.Writer, issues []pkg.LintIssue) error {
+	for _, issue := range issues {
+		line := issue.String()
+		if issue.Severity == pkg.LintError {
+			line = color.RedString(line)
+		} else {
+			line = color.YellowString(line)
+		}
+		if _, err := fmt.Fprintln(out, line); err != nil {
+			return fmt.Errorf("error writing lint results: %w", err)
+		}
+	}
+
+	errorCount, warningCount := countLintIssues(issues)
+	if _, err := fmt.Fprintf(out, "%d error(s), %d warning(s)\n", errorCount, warningCount); err != nil {
+		return fmt.Errorf("error writing lint results: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(out io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("error writing lint results: %w", err)
+	}
+	return nil
+}
+
+// The subset of SARIF 2.1.0 (https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html) needed to report lint
+// results to code scanning tools
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+func newSarifLog(issues []pkg.LintIssue, migrationDir string) sarifLog {
+	var rules []sarifRule
+	for _, id := range slices.Sorted(maps.Keys(pkg.LintRules)) {
+		rules = append(rules, sarifRule{ID: id, ShortDescription: sarifMessage{Text: pkg.LintRules[id]}})
+	}
+
+	results := make([]sarifResult, 0, len(issues))
+	for _, issue := range issues {
+		// Issues with the directory as a whole are reported against the directory
+		uri := path.Join(filepath.ToSlash(migrationDir), issue.File)
+		results = append(results, sarifResult{
+			RuleID:    issue.Rule,
+			Level:     string(issue.Severity),
+			Message:   sarifMessage{Text: issue.Message},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: uri}}}},
+		})
+	}
+
+	return sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "helm-migrate-values",
+				InformationURI: "https://github.com/OctopusDeploy/helm-migrate-values",
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	}
+}
@@ -29,5 +29,6 @@ func main() {
 
 	if err := cmd.Execute(); err != nil {
 		fmt.Println(err)
+		os.Exit(1)
 	}
 }
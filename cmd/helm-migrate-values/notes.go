@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/octopusdeploylabs/helm-migrate-values/pkg"
+	"io"
+	"strings"
+)
+
+// writeMigrationNotes writes the notes from the metadata of each migration that was applied, so users know why their
+// values changed. Each migration is only described once.
+func writeMigrationNotes(w io.Writer, steps []pkg.MigrationStep) {
+	var sb strings.Builder
+	described := make(map[string]bool)
+	for _, step := range steps {
+		m := step.Migration
+		if m.Metadata == nil || described[m.Name] {
+			continue
+		}
+		described[m.Name] = true
+
+		title := m.Name
+		if m.Metadata.Title != "" {
+			title = fmt.Sprintf("%s (%s)", m.Metadata.Title, m.Name)
+		}
+		sb.WriteString(color.New(color.Bold).Sprint(title) + "\n")
+		for _, line := range strings.SplitAfter(m.Metadata.Notes(), "\n") {
+			if line != "" {
+				sb.WriteString("  " + colorizeNote(line))
+			}
+		}
+	}
+
+	if sb.Len() > 0 {
+		_, _ = fmt.Fprint(w, color.New(color.Bold).Sprint("Migration notes:")+"\n"+sb.String())
+	}
+}
+
+func colorizeNote(line string) string {
+	if strings.HasPrefix(line, "BREAKING:") {
+		return color.YellowString("%s", line)
+	}
+	return line
+}
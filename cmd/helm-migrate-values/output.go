@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/octopusdeploylabs/helm-migrate-values/pkg"
+	"gopkg.in/yaml.v2"
+	"strings"
+)
+
+// The formats of the migrated values
+const (
+	yamlOutput     = "yaml"
+	rawOutput      = "raw"
+	jsonOutput     = "json"
+	setFlagsOutput = "set-flags"
+)
+
+var outputFormats = []string{yamlOutput, rawOutput, jsonOutput, setFlagsOutput}
+
+// outputExtensions are the extensions of the files written to the output directory of a batch, by format
+var outputExtensions = map[string]string{
+	yamlOutput:     ".yaml",
+	rawOutput:      ".yaml",
+	jsonOutput:     ".json",
+	setFlagsOutput: ".txt",
+}
+
+// formatValues formats the migrated values. If the values came from a values file, the YAML formats use the
+// document, which keeps the file's comments and formatting.
+func formatValues(values map[string]interface{}, doc *pkg.ValuesDocument, format string) ([]byte, error) {
+	switch format {
+	case jsonOutput:
+		data, err := json.MarshalIndent(pkg.NormalizeValues(values), "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("migrated values cannot be converted to json: %w", err)
+		}
+		return append(data, '\n'), nil
+	case setFlagsOutput:
+		flags, err := pkg.SetFlags(values)
+		if err != nil {
+			return nil, err
+		}
+		var sb strings.Builder
+		for _, f := range flags {
+			sb.WriteString(f.Flag + " " + shellQuote(f.Assignment) + "\n")
+		}
+		return []byte(sb.String()), nil
+	default:
+		if doc != nil {
+			if err := doc.Update(values); err != nil {
+				return nil, fmt.Errorf("migrated values are in an invalid format: %w", err)
+			}
+			return doc.Bytes()
+		}
+		data, err := yaml.Marshal(values)
+		if err != nil {
+			return nil, fmt.Errorf("migrated values are in an invalid format: %w", err)
+		}
+		return data, nil
+	}
+}
+
+// shellQuote quotes the argument for a POSIX shell, if it contains any characters the shell would interpret
+func shellQuote(arg string) string {
+	if arg != "" && strings.IndexFunc(arg, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:@+%,", r))
+	}) == -1 {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
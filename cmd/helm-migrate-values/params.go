@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/octopusdeploylabs/helm-migrate-values/pkg"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v2"
+	"io"
+	"os"
+	"strings"
+)
+
+// loadParams returns the values of the migration parameters from the --params-file and --param flags. Values given
+// with --param replace those in the file.
+func loadParams(paramsFile string, assignments []string) (map[string]interface{}, error) {
+	params := make(map[string]interface{})
+	if paramsFile != "" {
+		data, err := os.ReadFile(paramsFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading parameters file: %w", err)
+		}
+		if err = yaml.Unmarshal(data, &params); err != nil {
+			return nil, fmt.Errorf("error parsing parameters file %s: %w", paramsFile, err)
+		}
+		if params == nil {
+			params = make(map[string]interface{})
+		}
+	}
+
+	for _, assignment := range assignments {
+		name, value, err := pkg.ParseParam(assignment)
+		if err != nil {
+			return nil, err
+		}
+		params[name] = value
+	}
+	return params, nil
+}
+
+// newParamPrompt returns a prompt for the values of migration parameters, or nil if the input is not a terminal, in
+// which case missing parameters are an error. The prompts are written to errOut, so they are not mixed with the
+// migrated values.
+func newParamPrompt(in io.Reader, errOut io.Writer) func(param pkg.MigrationParam) (string, error) {
+	f, ok := in.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return nil
+	}
+
+	reader := bufio.NewReader(in)
+	return func(param pkg.MigrationParam) (string, error) {
+		if param.Description != "" {
+			_, _ = fmt.Fprintln(errOut, strings.TrimSpace(param.Description))
+		}
+		paramType := param.Type
+		if paramType == "" {
+			paramType = pkg.StringParam
+		}
+		_, _ = fmt.Fprintf(errOut, "%s (%s): ", param.Name, paramType)
+
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(answer), nil
+	}
+}
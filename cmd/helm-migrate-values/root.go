@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"github.com/Masterminds/semver/v3"
 	"github.com/octopusdeploylabs/helm-migrate-values/internal"
 	"github.com/octopusdeploylabs/helm-migrate-values/pkg"
 	"github.com/pkg/errors"
@@ -9,14 +10,17 @@ import (
 	"github.com/spf13/pflag"
 	"gopkg.in/yaml.v2"
 	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/release"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
-	"regexp"
-	"strconv"
+	"slices"
 	"strings"
+	"sync"
 )
 
 const cmdDescription = `Migrate the user-supplied values of a Helm release to the current version of its chart's values schema.
@@ -32,11 +36,37 @@ should be stored in the chart itself as:
 	{CHART_DIR}/value-migrations/to-v{VERSION_TO}.yaml
 
 		CHART_DIR is directory in which the Helm chart is defined
-		VERSION_TO represents the major version of the values schema. These should use the same versioning as the chart itself.
+		VERSION_TO represents the semantic version of the values schema (e.g. 2, 0.7 or 2.3.0). These should use the same versioning as the chart itself.
+
+A template starting with "# migration-mode: merge" is merged over the values instead of replacing them.
+Moves and renames can be written as declarative operations in to-v{VERSION_TO}.ops.yaml.
+JSON Patch and JSON Merge Patch migrations are read from to-v{VERSION_TO}.patch.json and to-v{VERSION_TO}.merge.yaml.
+Down migrations in from-v{VERSION}.yaml are applied when the target chart is older than the release's chart.
+Use --apply to upgrade the release with the migrated values.
+Use --diff to review the changes to the values.
+The migrated values are validated against the target chart's values.schema.json, unless --skip-schema-validation is set.
+Use --verify-render to check that the target chart renders with the migrated values.
+Use the test subcommand to check the migrations against the fixtures in value-migrations/tests.
+Use the lint subcommand to check the migrations for problems.
+Use the scaffold subcommand to draft a migration from the default values of two versions of a chart.
+The migrations of each subchart are applied to the values under the subchart's name or alias.
+Use --all-releases to migrate every release of the chart, giving only the CHART argument.
+Use --values-file with --from-version to migrate a values file without a cluster.
+Migrated values files keep their comments, key order and formatting.
+Use --output to choose the format of the migrated values: yaml, raw, json or set-flags.
+Use --revision to migrate the values of an earlier revision of the release.
+The values are taken from the release's last deployed revision, e.g. the one before a failed upgrade.
+A chart can declare its values schema version with the helm-migrate-values/schema-version annotation.
+The migrated values record the schema version they were migrated to, so later runs do not migrate them again.
+A migration can have a to-v{VERSION_TO}.meta.yaml metadata file, whose notes are written to standard error.
+Use --param or --params-file to supply the parameters that migrations declare.
+Templates can use Helm's template functions, and partials defined in value-migrations/_helpers.tpl.
+A migration whose metadata sets templateContext: full can read .Release, .FromChart, .ToChart, .Capabilities and .Files.
 
 Arguments:
   RELEASE
     The name of the release you want to migrate.
+    A release named test, lint or scaffold is given after --, e.g. helm migrate-values -- test CHART.
   
   CHART
 	The fully qualified name of the chart to use. This should match the chart used by the specified Helm release.
@@ -52,118 +82,518 @@ func NewRootCmd(actionConfig *action.Configuration, settings *cli.EnvSettings, o
 		Use:   "migrate-values [RELEASE] [CHART] [flags]",
 		Short: "helm migrator for values schemas",
 		Long:  cmdDescription,
-		Args:  cobra.MinimumNArgs(2),
+		Args:  cobra.MinimumNArgs(1),
 	}
 
-	flags := cmd.PersistentFlags()
-	settings.AddFlags(flags)
-	var outputFile string
-	flags.StringVarP(&outputFile, "output-file", "o", "",
-		"The output file to which the result is saved. Standard output is used if this option is not set.")
-	var migrationDir string
-	flags.StringVar(&migrationDir, "migration-dir", "value-migrations", "Specifies the relative path to the directory containing migration definition files. The path should be relative to the Helm chart directory.")
+	// The flags for the cluster, the chart and its migrations are shared with the subcommands
+	persistentFlags := cmd.PersistentFlags()
+	settings.AddFlags(persistentFlags)
+	opts := &runOptions{}
+	persistentFlags.StringVar(&opts.migrationDir, "migration-dir", pkg.DefaultMigrationsDir, "Specifies the relative path to the directory containing migration definition files. The path should be relative to the Helm chart directory.")
+
+	// We use the install action for locating the chart
+	installAction := action.NewInstall(actionConfig)
+	internal.AddChartPathOptionsFlags(persistentFlags, &installAction.ChartPathOptions)
 
-	runner := newRunner(actionConfig, flags, settings, out, &migrationDir, &outputFile, log)
+	flags := cmd.Flags()
+	flags.StringVarP(&opts.outputFile, "output-file", "o", "",
+		"The output file to which the result is saved. Standard output is used if this option is not set.")
+	flags.StringVar(&opts.output, "output", yamlOutput, fmt.Sprintf("The format of the migrated values, one of: %s. yaml output to standard output is preceded by the name of the release, while raw output is only the values.", strings.Join(outputFormats, ", ")))
+	flags.BoolVar(&opts.apply, "apply", false, "Upgrade the release to the chart using the migrated values, instead of only outputting them.")
+	flags.BoolVar(&opts.skipSchemaValidation, "skip-schema-validation", false, "Skip validating the migrated values against the target chart's values.schema.json.")
+	flags.BoolVar(&opts.verifyRender, "verify-render", false, "Render the target chart with the migrated values, as helm template would, and fail if rendering fails.")
+	flags.BoolVar(&opts.diff, "diff", false, "Output a diff of the release's user-supplied values and the migrated values, with a summary of the changes. If --output-file is set, the migrated values are still written to the file.")
+	flags.BoolVar(&opts.allReleases, "all-releases", false, "Migrate every deployed release that uses the chart, instead of a single release. Only the CHART argument is given.")
+	flags.BoolVarP(&opts.allNamespaces, "all-namespaces", "A", false, "With --all-releases, migrate releases in all namespaces, instead of only the current namespace.")
+	flags.StringVarP(&opts.selector, "selector", "l", "", "With --all-releases, only migrate releases whose labels match the selector (e.g. -l key1=value1,key2=value2).")
+	flags.StringVar(&opts.outputDir, "output-dir", "", "With --all-releases, the directory to which the migrated values of each release are saved, as {NAMESPACE}/{RELEASE}.yaml.")
+	flags.IntVar(&opts.parallelism, "parallelism", 4, "With --all-releases, the number of releases to migrate at the same time.")
+	flags.StringVar(&opts.stateFile, "state-file", "", "With --all-releases, a file recording the releases that have been migrated. If the batch is interrupted, run it again with the same state file to resume it.")
+	flags.StringVar(&opts.valuesFile, "values-file", "", "Migrate the values in a file, or standard input if '-', instead of a release's values. Only the CHART argument is given, and --from-version is required unless the values record the version they were migrated to.")
+	flags.StringVar(&opts.fromVersion, "from-version", "", "The values schema version the values are for, instead of the release chart's schema version. Required with --values-file, unless the values record the version they were migrated to.")
+	flags.BoolVar(&opts.allowPending, "allow-pending", false, "Migrate the values of the last deployed revision of the release, even if an install, upgrade, rollback or uninstall of the release is in progress.")
+	flags.StringVar(&opts.forceFrom, "force-from", "", "Migrate the values from this schema version, even if they record that they were migrated to a later version.")
+	flags.StringArrayVar(&opts.params, "param", nil, "The value of a migration parameter, as NAME=VALUE. Can be given multiple times.")
+	flags.StringVar(&opts.paramsFile, "params-file", "", "A YAML file of migration parameter values, by name. Values given with --param replace those in the file.")
+	flags.IntVar(&opts.revision, "revision", 0, "Migrate the values of this revision of the release, e.g. the last successful revision before a failed upgrade, instead of the deployed revision.")
+
+	runner := newRunner(actionConfig, flags, settings, out, installAction, opts, log)
 	cmd.RunE = runner
 
+	cmd.AddCommand(newTestCmd(settings, out, installAction, opts, log))
+	cmd.AddCommand(newLintCmd(settings, out, installAction, opts, log))
+	cmd.AddCommand(newScaffoldCmd(settings, out, installAction, opts, log))
+
 	return cmd, nil
 }
 
-func newRunner(actionConfig *action.Configuration, flags *pflag.FlagSet, settings *cli.EnvSettings, out io.Writer, migrationDir *string, outputFile *string, log pkg.Logger) func(cmd *cobra.Command, args []string) error {
-	// We use the install action for locating the chart
-	var installAction = action.NewInstall(actionConfig)
+// runOptions holds the values of the root command's flags
+type runOptions struct {
+	outputFile           string
+	output               string
+	migrationDir         string
+	apply                bool
+	diff                 bool
+	skipSchemaValidation bool
+	verifyRender         bool
+	allReleases          bool
+	allNamespaces        bool
+	selector             string
+	outputDir            string
+	parallelism          int
+	stateFile            string
+	valuesFile           string
+	fromVersion          string
+	revision             int
+	allowPending         bool
+	forceFrom            string
+	params               []string
+	paramsFile           string
+	// migrationParams are the values of the migration parameters from --param and --params-file
+	migrationParams map[string]interface{}
+	// prompt asks for missing migration parameters, and is nil if they cannot be prompted for
+	prompt func(param pkg.MigrationParam) (string, error)
+}
+
+func (o *runOptions) validate(args []string) error {
+	if !slices.Contains(outputFormats, o.output) {
+		return errors.Errorf("invalid --output %s, expected one of: %s", o.output, strings.Join(outputFormats, ", "))
+	}
+
+	if o.valuesFile != "" {
+		return o.validateValuesFile(args)
+	}
+	if o.revision < 0 {
+		return errors.New("--revision must be a positive revision number")
+	}
+	if o.fromVersion != "" && o.forceFrom != "" {
+		return errors.New("--from-version and --force-from cannot be used together")
+	}
+	if o.revision != 0 && o.allowPending {
+		return errors.New("--allow-pending cannot be used with --revision, which migrates the revision whatever its status")
+	}
+
+	if !o.allReleases {
+		switch {
+		case len(args) < 2:
+			return errors.New("expected the RELEASE and CHART arguments, or --all-releases with only the CHART argument")
+		case o.allNamespaces, o.selector != "", o.outputDir != "", o.stateFile != "":
+			return errors.New("--all-namespaces, --selector, --output-dir and --state-file can only be used with --all-releases")
+		}
+		return nil
+	}
+
+	switch {
+	case o.revision != 0:
+		return errors.New("--revision cannot be used with --all-releases")
+	case o.fromVersion != "", o.forceFrom != "":
+		return errors.New("--from-version and --force-from cannot be used with --all-releases, as each release's values may be for a different version")
+	case len(args) != 1:
+		return errors.Errorf("expected only the CHART argument with --all-releases, unexpected arguments: %v", strings.Join(args[1:], ", "))
+	case o.outputFile != "":
+		return errors.New("--output-file cannot be used with --all-releases, use --output-dir instead")
+	case o.diff:
+		return errors.New("--diff cannot be used with --all-releases")
+	case o.outputDir == "" && !o.apply:
+		return errors.New("--all-releases requires --output-dir, --apply, or both")
+	case o.parallelism < 1:
+		return errors.New("--parallelism must be at least 1")
+	}
+	return nil
+}
+
+func (o *runOptions) validateValuesFile(args []string) error {
+	switch {
+	case len(args) != 1:
+		return errors.Errorf("expected only the CHART argument with --values-file, unexpected arguments: %v", strings.Join(args[1:], ", "))
+	case o.allReleases:
+		return errors.New("--values-file cannot be used with --all-releases")
+	case o.revision != 0, o.allowPending:
+		return errors.New("--revision and --allow-pending cannot be used with --values-file")
+	case o.apply:
+		return errors.New("--values-file cannot be used with --apply, as there is no release to upgrade")
+	case o.allNamespaces, o.selector != "", o.outputDir != "", o.stateFile != "":
+		return errors.New("--all-namespaces, --selector, --output-dir and --state-file can only be used with --all-releases")
+	}
+	return nil
+}
+
+func newRunner(actionConfig *action.Configuration, flags *pflag.FlagSet, settings *cli.EnvSettings, out io.Writer, installAction *action.Install, opts *runOptions, log pkg.Logger) func(cmd *cobra.Command, args []string) error {
 	var listAction = action.NewList(actionConfig)
+	var getAction = action.NewGet(actionConfig)
+	var historyAction = action.NewHistory(actionConfig)
+	var upgradeAction = action.NewUpgrade(actionConfig)
 
-	internal.AddChartPathOptionsFlags(flags, &installAction.ChartPathOptions)
+	internal.AddUpgradeFlags(flags, upgradeAction)
 
 	return func(cmd *cobra.Command, args []string) error {
-		helmDriver := os.Getenv("HELM_DRIVER")
-		if err := actionConfig.Init(settings.RESTClientGetter(), settings.Namespace(), helmDriver, log.Debug); err != nil {
+		if err := opts.validate(args); err != nil {
 			return err
 		}
 
-		name, chart, err := nameAndChart(args)
+		var err error
+		if opts.migrationParams, err = loadParams(opts.paramsFile, opts.params); err != nil {
+			return err
+		}
+		// Releases in a batch are migrated in parallel, and a values file may be read from standard input, so neither
+		// can prompt for parameters
+		if !opts.allReleases && opts.valuesFile != "-" {
+			opts.prompt = newParamPrompt(cmd.InOrStdin(), cmd.ErrOrStderr())
+		}
+
+		var name, chartRef string
+		if opts.allReleases || opts.valuesFile != "" {
+			chartRef = args[0]
+		} else {
+			if name, chartRef, err = nameAndChart(args); err != nil {
+				return err
+			}
+		}
+
+		chartDir, chrt, cleanup, err := locateAndLoadChart(chartRef, installAction, settings, log)
 		if err != nil {
 			return err
 		}
+		defer cleanup()
 
-		chartDir, cleanupDirectory, err := internal.LocateChart(chart, installAction, settings, log)
+		log.Debug("Using chart at: %s", chartDir)
+
+		targetVer, err := pkg.SchemaVersion(chrt)
 		if err != nil {
-			return fmt.Errorf("failed to download chart: %w", err)
+			return err
 		}
+		target := &targetChart{dir: chartDir, chart: chrt, version: targetVer}
 
-		if cleanupDirectory {
-			defer func() {
-				log.Debug("Cleaning up extracted chart at %s", *chartDir)
-				if err = os.RemoveAll(*chartDir); err != nil {
-					err = fmt.Errorf("failed to cleanup extracted chart: %w", err)
-				}
-			}()
+		// A values file is migrated without a cluster
+		if opts.valuesFile != "" {
+			return migrateValuesFile(out, cmd.ErrOrStderr(), cmd.InOrStdin(), target, settings, opts, log)
 		}
 
-		if chartDir != nil {
-			log.Debug("Using chart at: %s", *chartDir)
+		namespace := settings.Namespace()
+		if opts.allNamespaces {
+			namespace = ""
 		}
 
-		release, err := internal.GetRelease(name, listAction)
+		helmDriver := os.Getenv("HELM_DRIVER")
+		if err = actionConfig.Init(settings.RESTClientGetter(), namespace, helmDriver, log.Debug); err != nil {
+			return err
+		}
+
+		// The cluster's capabilities are only discovered if rendering is verified, or a migration uses them
+		caps := sync.OnceValue(func() *chartutil.Capabilities {
+			return internal.ClusterCapabilities(actionConfig, log)
+		})
+
+		if opts.allReleases {
+			listAction.AllNamespaces = opts.allNamespaces
+			listAction.Selector = opts.selector
+			return runBatch(out, cmd.ErrOrStderr(), target, listAction, historyAction, upgradeAction, settings, caps, opts, log)
+		}
+
+		var release *release.Release
+		if opts.revision != 0 {
+			release, err = internal.GetReleaseRevision(name, opts.revision, getAction)
+		} else {
+			release, err = internal.GetRelease(name, historyAction, opts.allowPending, log)
+		}
 		if err != nil {
 			return err
 		}
 
-		if release != nil {
-			log.Debug("Release is using chart: %s", release.Chart.Metadata.Name)
-			log.Debug("Release is currently on chart version: %s", release.Chart.Metadata.Version)
+		log.Debug("Release is using chart: %s", release.Chart.Metadata.Name)
+		log.Debug("Release revision %d is on chart version: %s", release.Version, release.Chart.Metadata.Version)
 
-			if release.Config != nil && log.IsDebug {
-				value, err := yaml.Marshal(release.Config)
-				if err != nil {
-					log.Debug("Release has the following user-supplied values:\n%s", value)
-				}
+		if release.Config != nil && log.IsDebug {
+			value, err := yaml.Marshal(release.Config)
+			if err != nil {
+				log.Debug("Release has the following user-supplied values:\n%s", value)
 			}
 		}
 
-		if release.Config != nil && len(release.Config) > 0 {
+		if len(release.Config) == 0 {
+			log.Information("No migration required for release %s", name)
+			return nil
+		}
+
+		migration, err := migrateRelease(release, target, caps, opts, log)
+		if err != nil {
+			return err
+		}
+
+		migratedConfig := migration.values()
+		if len(migratedConfig) == 0 {
+			return nil
+		}
+		writeMigrationNotes(cmd.ErrOrStderr(), migration.result.Steps)
+
+		migratedValues, err := formatValues(migratedConfig, nil, opts.output)
+		if err != nil {
+			return err
+		}
 
-			majorVerRegEx := regexp.MustCompile(`^(\d+)\..*`)
-			matches := majorVerRegEx.FindStringSubmatch(release.Chart.Metadata.Version)
-			if len(matches) == 0 {
-				return fmt.Errorf("failed to extract major version from chart version: %s", release.Chart.Metadata.Version)
+		if opts.outputFile != "" {
+			if err = writeOutputValues(err, opts.outputFile, migratedValues); err != nil {
+				return err
+			}
+		} else if !opts.apply && !opts.diff {
+			message := string(migratedValues)
+			if opts.output == yamlOutput {
+				message = fmt.Sprintf("Migrated user-supplied values for release %s:\n%s", name, message)
 			}
-			relMajorVer, _ := strconv.Atoi(matches[1])
-			migrationsPath := filepath.Join(*chartDir, *migrationDir)
+			if _, err = fmt.Fprint(out, message); err != nil {
+				return fmt.Errorf("error writing migrated values to standard output: %w", err)
+			}
+		}
 
-			// vTo is always nil, because it really only makes sense to migrate to the current chart version.
-			// The migrations library does support migrating to a specific version though.
-			migratedConfig, err := pkg.MigrateFromPath(release.Config, relMajorVer, nil, migrationsPath, log)
-			if err != nil {
+		if opts.diff {
+			fromName := fmt.Sprintf("%s revision %d (schema version %s)", name, release.Version, migration.fromVersion)
+			toName := fmt.Sprintf("%s (schema version %s)", name, targetVer)
+			if err = writeDiff(out, release.Config, migratedConfig, fromName, toName); err != nil {
 				return err
 			}
+		}
 
-			if len(migratedConfig) > 0 {
-
-				migratedValues, err := yaml.Marshal(migratedConfig)
-				if err != nil {
-					return fmt.Errorf("migrated values are in an invalid format: %w", err)
-				}
-
-				if *outputFile == "" {
-					message := fmt.Sprintf("Migrated user-supplied values for release %s:\n%s", name, string(migratedValues))
-					if _, err = fmt.Fprint(out, message); err != nil {
-						return fmt.Errorf("error writing migrated values to standard output: %w", err)
-					}
-				} else {
-					if err = writeOutputValues(err, *outputFile, migratedValues); err != nil {
-						return err
-					}
-				}
+		if opts.apply {
+			upgradeAction.Namespace = settings.Namespace()
+			if err = applyMigratedValues(name, target, migratedConfig, upgradeAction, log); err != nil {
+				return err
 			}
+		}
+
+		return nil
+	}
+}
+
+// targetChart is the chart that releases are migrated to
+type targetChart struct {
+	dir     string
+	chart   *chart.Chart
+	version *semver.Version
+}
+
+// releaseMigration is the result of migrating the values of a release to the target chart
+type releaseMigration struct {
+	fromVersion *semver.Version
+	// result is nil if there were no migrations to apply
+	result *pkg.MigrationResult
+}
 
+func (m *releaseMigration) values() map[string]interface{} {
+	if m.result == nil {
+		return nil
+	}
+	return m.result.Values
+}
+
+// migrationSource is the values to migrate, and the chart version they are for
+type migrationSource struct {
+	name      string
+	namespace string
+	values    map[string]interface{}
+	version   *semver.Version
+	// chart is the chart the values are currently used with, which is nil if it is not known
+	chart *chart.Chart
+	// revision is the revision of the release the values are from, or 0 if they are not from a release
+	revision int
+}
+
+// migrateRelease migrates the user-supplied values of the release to the target chart, and validates the result
+func migrateRelease(release *release.Release, target *targetChart, caps func() *chartutil.Capabilities, opts *runOptions, log pkg.Logger) (*releaseMigration, error) {
+	relVer, err := releaseSchemaVersion(release, opts, log)
+	if err != nil {
+		return nil, err
+	}
+
+	source := &migrationSource{
+		name:      release.Name,
+		namespace: release.Namespace,
+		revision:  release.Version,
+		values:    release.Config,
+		version:   relVer,
+		chart:     release.Chart,
+	}
+	return migrateValues(source, target, caps, opts, log)
+}
+
+// releaseSchemaVersion returns the schema version of the release's values, see valuesSchemaVersion
+func releaseSchemaVersion(release *release.Release, opts *runOptions, log pkg.Logger) (*semver.Version, error) {
+	return valuesSchemaVersion("release "+release.Name, release.Config, release.Chart, opts, log)
+}
+
+// valuesSchemaVersion returns the schema version of the values, which are named in errors. This is the schema version
+// of the chart the values are used with, which is nil if it is not known, or the version given explicitly, e.g. if the
+// values were migrated by hand. A version recorded in the values when they were migrated is checked against it, so
+// migrations are not applied twice. Without a chart or an explicit version, the recorded version is used.
+func valuesSchemaVersion(name string, values map[string]interface{}, chrt *chart.Chart, opts *runOptions, log pkg.Logger) (*semver.Version, error) {
+	if opts.forceFrom != "" {
+		version, err := semver.NewVersion(opts.forceFrom)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse --force-from %s: %w", opts.forceFrom, err)
+		}
+		return version, nil
+	}
+
+	migratedVer, err := pkg.MigratedVersion(values)
+	if err != nil {
+		log.Warning("Ignoring the migrated version recorded in the values of %s: %v", name, err)
+		migratedVer = nil
+	}
+
+	if opts.fromVersion != "" {
+		version, err := semver.NewVersion(opts.fromVersion)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse --from-version %s: %w", opts.fromVersion, err)
+		}
+		if migratedVer != nil && migratedVer.GreaterThan(version) {
+			return nil, fmt.Errorf("the values of %s record that they were migrated to schema version %s, which is later than --from-version %s. Use --force-from %s to migrate them from %s anyway", name, migratedVer, version, opts.fromVersion, version)
+		}
+		return version, nil
+	}
+
+	if chrt == nil {
+		if migratedVer == nil {
+			return nil, fmt.Errorf("the values of %s do not record the schema version they were migrated to, use --from-version to give the version they are for", name)
+		}
+		log.Debug("The values of %s record that they were migrated to schema version %s", name, migratedVer)
+		return migratedVer, nil
+	}
+
+	version, err := pkg.SchemaVersion(chrt)
+	if err != nil {
+		return nil, err
+	}
+	// The values may already have been migrated, e.g. if the upgrade to the new chart failed, or the release may have
+	// been downgraded with values that were migrated before, so which version they are for cannot be known
+	if migratedVer != nil && migratedVer.GreaterThan(version) {
+		return nil, fmt.Errorf("the values of %s record that they were migrated to schema version %s, which is later than the schema version %s of its chart. Either the values were already migrated, so use --force-from %s to apply only the later migrations, or the record is stale, e.g. after a downgrade, so use --force-from %s to migrate them from the chart's version", name, migratedVer, version, migratedVer, version)
+	}
+	return version, nil
+}
+
+// migrateValues migrates the values to the target chart, and validates the result, which records the schema version
+// the values were migrated to. Down migrations and subchart migrations are only applied if the source's chart is known.
+func migrateValues(source *migrationSource, target *targetChart, caps func() *chartutil.Capabilities, opts *runOptions, log pkg.Logger) (*releaseMigration, error) {
+	relVer := source.version
+	// The migrations do not see the recorded version, which is recorded again once the values are migrated
+	values := pkg.WithoutMigratedVersion(source.values)
+	var err error
+
+	log.Debug("Migrating values from schema version %s to %s", relVer, target.version)
+
+	var mp pkg.MigrationProvider
+	if target.version.LessThan(relVer) {
+		// Down migrations are defined by the chart that introduced the schema change, which is the chart
+		// the release is currently using rather than the older target chart.
+		if source.chart == nil {
+			return nil, fmt.Errorf("cannot downgrade values from chart version %s to %s without the chart they are from, as down migrations are defined by the newer chart", relVer, target.version)
+		}
+		log.Debug("Downgrading values using the down migrations of the release's chart")
+		mp, err = pkg.NewChartFilesMigrationProvider(source.chart.Files, chartRelativePath(source.chart.Name(), opts.migrationDir))
+		if err != nil {
+			return nil, fmt.Errorf("error loading down migrations from the release's chart: %w", err)
+		}
+	} else {
+		mp, err = pkg.LoadMigrationsFromPath(internal.MigrationDir(target.dir, opts.migrationDir), log)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	env := &pkg.MigrationEnvironment{
+		Release:      pkg.TemplateRelease{Name: source.name, Namespace: source.namespace, Revision: source.revision},
+		FromChart:    source.chart,
+		ToChart:      target.chart,
+		Capabilities: caps,
+	}
+
+	var result *pkg.MigrationResult
+	if mp != nil {
+		result, err = newMigrator(mp, env, opts, log).Migrate(values, relVer, target.version)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Each subchart is migrated by its own migrations, after the chart's own migrations. The versions of the subcharts
+	// are only known from the source's chart.
+	var subchartResult *pkg.MigrationResult
+	if source.chart != nil {
+		subchartValues := values
+		if result != nil {
+			subchartValues = result.Values
+		}
+		if subchartResult, err = newMigrator(nil, env, opts, log).MigrateSubcharts(subchartValues, source.chart, target.chart); err != nil {
+			return nil, err
+		}
+	} else {
+		log.Debug("Skipping subchart migrations, as the versions of the subcharts the values are from are not known")
+	}
+	if subchartResult != nil {
+		if result == nil {
+			result = subchartResult
 		} else {
-			log.Information("No migration required for release %s", name)
+			result.Values = subchartResult.Values
+			result.Steps = append(result.Steps, subchartResult.Steps...)
 		}
+	}
 
-		return nil
+	migration := &releaseMigration{fromVersion: relVer, result: result}
+	if len(migration.values()) == 0 {
+		return migration, nil
+	}
+
+	if !opts.skipSchemaValidation {
+		log.Debug("Validating migrated values against the schema of chart %s", target.chart.Name())
+		if err = pkg.ValidateAgainstChartSchema(target.chart, result.Values); err != nil {
+			return nil, err
+		}
+	}
+	result.Values = recordMigratedVersion(result.Values, target, opts, log)
+
+	if opts.verifyRender {
+		var renderCaps *chartutil.Capabilities
+		if caps != nil {
+			renderCaps = caps()
+		}
+		if err = pkg.VerifyRender(target.chart, result, source.name, source.namespace, renderCaps, log); err != nil {
+			return nil, err
+		}
+	}
+
+	return migration, nil
+}
+
+// recordMigratedVersion records the schema version the values were migrated to in the values, unless the chart's
+// schema does not allow the reserved key
+func recordMigratedVersion(values map[string]interface{}, target *targetChart, opts *runOptions, log pkg.Logger) map[string]interface{} {
+	recorded := pkg.RecordMigratedVersion(values, target.version)
+	if !opts.skipSchemaValidation {
+		if err := pkg.ValidateAgainstChartSchema(target.chart, recorded); err != nil {
+			log.Warning("The schema of chart %s does not allow the %s key, so the schema version the values were migrated to is not recorded: %v", target.chart.Name(), pkg.MigratedVersionKey, err)
+			return values
+		}
 	}
+	return recorded
+}
+
+// newMigrator returns a migrator for the migrations of the provider, with the migration parameters from the options
+func newMigrator(mp pkg.MigrationProvider, env *pkg.MigrationEnvironment, opts *runOptions, log pkg.Logger) *pkg.Migrator {
+	return &pkg.Migrator{Provider: mp, Log: log, Params: opts.migrationParams, Prompt: opts.prompt, Environment: env}
+}
+
+// applyMigratedValues upgrades the release to the target chart with the migrated values, and reports the new revision
+func applyMigratedValues(name string, target *targetChart, migratedConfig map[string]interface{}, upgradeAction *action.Upgrade, log pkg.Logger) error {
+	upgraded, err := internal.UpgradeRelease(name, target.chart, migratedConfig, upgradeAction, log)
+	if err != nil {
+		return err
+	}
+
+	if internal.IsDryRun(upgradeAction) {
+		log.Information("Dry run: release %s would be upgraded to revision %d with chart version %s", upgraded.Name, upgraded.Version, upgraded.Chart.Metadata.Version)
+	} else {
+		log.Information("Release %s upgraded to revision %d with chart version %s (status: %s)", upgraded.Name, upgraded.Version, upgraded.Chart.Metadata.Version, upgraded.Info.Status)
+	}
+	return nil
 }
 
 func writeOutputValues(err error, outputFile string, migratedValues []byte) error {
@@ -191,6 +621,13 @@ func writeOutputValues(err error, outputFile string, migratedValues []byte) erro
 	return nil
 }
 
+// chartRelativePath converts a path relative to the located chart directory into a path relative to the chart root.
+// Packaged charts are extracted into a directory named after the chart, so such paths may start with the chart name.
+func chartRelativePath(chartName string, p string) string {
+	p = filepath.ToSlash(filepath.Clean(p))
+	return strings.TrimPrefix(p, chartName+"/")
+}
+
 func nameAndChart(args []string) (string, string, error) {
 	if len(args) > 2 {
 		return args[0], args[1], errors.Errorf("expected at most two arguments, unexpected arguments: %v", strings.Join(args[2:], ", "))
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"github.com/octopusdeploylabs/helm-migrate-values/pkg"
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/cli"
+	"io"
+	"path/filepath"
+)
+
+const scaffoldCmdDescription = `Generate a first draft of a migration from the default values of two versions of a chart.
+
+The default values in each chart's values.yaml are compared, and each removed value is matched with the added value it
+most likely moved to, when they have the same default value, or keys with the same or similar names. The matches are
+written as a declarative operations migration, or with --format template, as a merge mode template migration. Values
+that could not be matched are listed as TODO comments.
+
+The defaults alone cannot show every change to the values, so review the migration before adding it to the chart.
+
+Use --old-version and --new-version to choose the versions of a chart in a repository, e.g.
+
+	helm migrate-values scaffold my-repo/my-chart my-repo/my-chart --old-version 1.4.0 --new-version 2.0.0
+`
+
+const (
+	opsScaffoldFormat      = "ops"
+	templateScaffoldFormat = "template"
+)
+
+func newScaffoldCmd(settings *cli.EnvSettings, out io.Writer, installAction *action.Install, opts *runOptions, log pkg.Logger) *cobra.Command {
+	var format, oldVersion, newVersion string
+
+	cmd := &cobra.Command{
+		Use:          "scaffold [OLD_CHART] [NEW_CHART] [flags]",
+		Short:        "generate a draft migration between two versions of a chart",
+		Long:         scaffoldCmdDescription,
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != opsScaffoldFormat && format != templateScaffoldFormat {
+				return fmt.Errorf("unknown format '%s', expected %s or %s", format, opsScaffoldFormat, templateScaffoldFormat)
+			}
+
+			oldChart, err := loadChartVersion(args[0], oldVersion, installAction, settings, log)
+			if err != nil {
+				return fmt.Errorf("error loading old chart: %w", err)
+			}
+
+			newChart, err := loadChartVersion(args[1], newVersion, installAction, settings, log)
+			if err != nil {
+				return fmt.Errorf("error loading new chart: %w", err)
+			}
+
+			scaffold := pkg.ScaffoldMigration(oldChart.Values, newChart.Values)
+			header := fmt.Sprintf("Generated by helm migrate-values scaffold from the default values of %s %s and %s %s.\nReview each change, and resolve each TODO, before adding this migration to the chart.",
+				oldChart.Name(), oldChart.Metadata.Version, newChart.Name(), newChart.Metadata.Version)
+
+			// The migration is named after the new chart's values schema version
+			schemaVer, err := pkg.SchemaVersion(newChart)
+			if err != nil {
+				return err
+			}
+
+			var migration, fileName string
+			if format == templateScaffoldFormat {
+				migration, fileName = scaffold.Template(header), fmt.Sprintf("to-v%s.yaml", schemaVer.Original())
+			} else {
+				migration, fileName = scaffold.Operations(header), fmt.Sprintf("to-v%s.ops.yaml", schemaVer.Original())
+			}
+
+			if opts.outputFile != "" {
+				if err = writeOutputValues(nil, opts.outputFile, []byte(migration)); err != nil {
+					return err
+				}
+			} else if _, err = fmt.Fprint(out, migration); err != nil {
+				return fmt.Errorf("error writing migration to standard output: %w", err)
+			}
+
+			log.Information("Add the migration to the new chart as %s", filepath.Join(opts.migrationDir, fileName))
+			return nil
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&format, "format", opsScaffoldFormat, "The format of the generated migration: ops or template.")
+	f.StringVar(&oldVersion, "old-version", "", "The version constraint of the old chart, instead of --version.")
+	f.StringVar(&newVersion, "new-version", "", "The version constraint of the new chart, instead of --version.")
+	f.StringVarP(&opts.outputFile, "output-file", "o", "", "The file to which the migration is saved. Standard output is used if this option is not set.")
+
+	return cmd
+}
+
+// loadChartVersion loads a chart, using the given version constraint instead of the --version flag if it is set
+func loadChartVersion(chartRef string, version string, installAction *action.Install, settings *cli.EnvSettings, log pkg.Logger) (*chart.Chart, error) {
+	if version != "" {
+		defaultVersion := installAction.Version
+		installAction.Version = version
+		defer func() { installAction.Version = defaultVersion }()
+	}
+
+	_, chrt, cleanup, err := locateAndLoadChart(chartRef, installAction, settings, log)
+	if err != nil {
+		return nil, err
+	}
+	cleanup()
+
+	return chrt, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/octopusdeploylabs/helm-migrate-values/internal"
+	"github.com/octopusdeploylabs/helm-migrate-values/pkg"
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/cli"
+	"io"
+	"path/filepath"
+)
+
+const testCmdDescription = `Test the migrations of a chart against fixtures, without a cluster.
+
+Each fixture is a directory containing the values to migrate and the values they are expected to migrate to:
+
+	{CHART_DIR}/value-migrations/tests/{NAME}/input.yaml
+	{CHART_DIR}/value-migrations/tests/{NAME}/from-version
+	{CHART_DIR}/value-migrations/tests/{NAME}/expected.yaml
+
+A fixture migrates to the chart's version, unless the fixture directory contains a to-version file.
+
+The command reports whether each fixture passed, with a diff of the expected and migrated values for each failure,
+and returns an error if any fixture failed. Use --update to write the migrated values to each fixture's expected.yaml.
+`
+
+func newTestCmd(settings *cli.EnvSettings, out io.Writer, installAction *action.Install, opts *runOptions, log pkg.Logger) *cobra.Command {
+	var update bool
+
+	cmd := &cobra.Command{
+		Use:          "test [CHART] [flags]",
+		Short:        "test a chart's migrations against fixtures",
+		Long:         testCmdDescription,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			chartDir, chrt, cleanup, err := locateAndLoadChart(args[0], installAction, settings, log)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+
+			chartVer, err := pkg.SchemaVersion(chrt)
+			if err != nil {
+				return err
+			}
+
+			results, err := pkg.RunMigrationTests(internal.MigrationDir(chartDir, opts.migrationDir), chartVer, log)
+			if err != nil {
+				return err
+			}
+
+			if len(results) == 0 {
+				log.Warning("No migration tests found in %s", filepath.Join(opts.migrationDir, pkg.MigrationTestsDir))
+				return nil
+			}
+
+			return writeTestResults(out, results, update)
+		},
+	}
+
+	cmd.Flags().BoolVar(&update, "update", false, "Update each fixture's expected.yaml with the migrated values, instead of comparing them.")
+
+	return cmd
+}
+
+func writeTestResults(out io.Writer, results []pkg.MigrationTestResult, update bool) error {
+	failed := 0
+	for _, result := range results {
+		test := result.Test
+		switch {
+		case result.Err != nil:
+			failed++
+			_, _ = fmt.Fprintf(out, "%s %s: %v\n", color.RedString("ERROR"), test.Name, result.Err)
+		case update:
+			if err := result.UpdateExpected(); err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(out, "%s %s\n", color.GreenString("UPDATED"), test.Name)
+		case result.Passed():
+			_, _ = fmt.Fprintf(out, "%s %s\n", color.GreenString("PASS"), test.Name)
+		case test.Expected == nil:
+			failed++
+			_, _ = fmt.Fprintf(out, "%s %s: missing expected.yaml, use --update to create it\n", color.RedString("FAIL"), test.Name)
+		default:
+			failed++
+			_, _ = fmt.Fprintf(out, "%s %s\n", color.RedString("FAIL"), test.Name)
+			if err := writeDiff(out, test.Expected, result.Actual, "expected.yaml", "migrated values"); err != nil {
+				return err
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d migration tests failed", failed, len(results))
+	}
+
+	_, _ = fmt.Fprintf(out, "%d migration tests passed\n", len(results))
+	return nil
+}
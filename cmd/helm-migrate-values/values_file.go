@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"github.com/octopusdeploylabs/helm-migrate-values/pkg"
+	"helm.sh/helm/v3/pkg/cli"
+	"io"
+	"os"
+)
+
+// The release name used to render the chart, when verifying the migration of a values file
+const valuesFileReleaseName = "release-name"
+
+// migrateValuesFile migrates the values in the values file, or standard input, from the schema version given by
+// --from-version, or else the version recorded in the values when they were last migrated, to the target chart. Only the target chart's own migrations are applied, as the chart the values
+// are from is not known. The output keeps the comments, key order and formatting of the values that were not migrated.
+func migrateValuesFile(out io.Writer, errOut io.Writer, stdin io.Reader, target *targetChart, settings *cli.EnvSettings, opts *runOptions, log pkg.Logger) error {
+	doc, err := readValuesFile(opts.valuesFile, stdin)
+	if err != nil {
+		return err
+	}
+
+	values, err := doc.Values()
+	if err != nil {
+		return err
+	}
+
+	if len(values) == 0 {
+		log.Information("No migration required for values file %s", opts.valuesFile)
+		return nil
+	}
+
+	fromVer, err := valuesSchemaVersion("values file "+opts.valuesFile, values, nil, opts, log)
+	if err != nil {
+		return err
+	}
+
+	source := &migrationSource{
+		name:      valuesFileReleaseName,
+		namespace: settings.Namespace(),
+		values:    values,
+		version:   fromVer,
+	}
+
+	// Rendering and migrations use the default capabilities, as the cluster is not used
+	migration, err := migrateValues(source, target, nil, opts, log)
+	if err != nil {
+		return err
+	}
+
+	migratedConfig := migration.values()
+	if len(migratedConfig) == 0 {
+		return nil
+	}
+	writeMigrationNotes(errOut, migration.result.Steps)
+
+	// There is no release to name, so yaml output is the same as raw output
+	migratedValues, err := formatValues(migratedConfig, doc, opts.output)
+	if err != nil {
+		return err
+	}
+
+	if opts.outputFile != "" {
+		if err = writeOutputValues(nil, opts.outputFile, migratedValues); err != nil {
+			return err
+		}
+	} else if !opts.diff {
+		// Only the values are output, so they can be piped to another command
+		if _, err = out.Write(migratedValues); err != nil {
+			return fmt.Errorf("error writing migrated values to standard output: %w", err)
+		}
+	}
+
+	if opts.diff {
+		fromName := fmt.Sprintf("%s (schema version %s)", opts.valuesFile, fromVer)
+		toName := fmt.Sprintf("%s (schema version %s)", opts.valuesFile, target.version)
+		if err = writeDiff(out, values, migratedConfig, fromName, toName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readValuesFile(path string, stdin io.Reader) (*pkg.ValuesDocument, error) {
+	if path == "-" {
+		return pkg.ReadValuesDocument(stdin)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening values file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	doc, err := pkg.ReadValuesDocument(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return doc, nil
+}
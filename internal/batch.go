@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// BatchState records the releases a batch migration has completed, so an interrupted batch can resume where it stopped
+type BatchState struct {
+	Chart    string                       `json:"chart"`
+	Version  string                       `json:"version"`
+	Releases map[string]BatchReleaseState `json:"releases"`
+
+	path string
+	lock sync.Mutex
+}
+
+type BatchReleaseState struct {
+	Status     string `json:"status"`
+	OutputFile string `json:"outputFile,omitempty"`
+}
+
+// LoadBatchState loads the state of a batch migrating releases to the chart version from the file. The state is empty
+// if the file does not exist, or is for a different chart version. If the path is empty, the state is not saved.
+func LoadBatchState(path string, chart string, version string) (*BatchState, error) {
+	state := &BatchState{Chart: chart, Version: version, Releases: map[string]BatchReleaseState{}, path: path}
+	if path == "" {
+		return state, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("error reading batch state file: %w", err)
+	}
+
+	var saved BatchState
+	if err = json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("error parsing batch state file %s: %w", path, err)
+	}
+
+	if saved.Chart == chart && saved.Version == version && saved.Releases != nil {
+		state.Releases = saved.Releases
+	}
+	return state, nil
+}
+
+// Get returns the recorded state of the release, if the batch has completed it
+func (s *BatchState) Get(key string) (BatchReleaseState, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	release, ok := s.Releases[key]
+	return release, ok
+}
+
+// Complete records that the batch has completed the release, and saves the state
+func (s *BatchState) Complete(key string, release BatchReleaseState) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.Releases[key] = release
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error formatting batch state: %w", err)
+	}
+
+	// Write to a temporary file first, so the state is not lost if the batch is interrupted while saving
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("error saving batch state: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Close()
+	} else {
+		_ = tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		return fmt.Errorf("error saving batch state: %w", err)
+	}
+	return nil
+}
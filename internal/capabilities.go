@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"github.com/octopusdeploylabs/helm-migrate-values/pkg"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"k8s.io/client-go/discovery"
+)
+
+// ClusterCapabilities discovers the Kubernetes version and APIs of the cluster, in the same way as Helm does when
+// installing a chart. If the cluster cannot be reached, nil is returned so that the default capabilities are used.
+func ClusterCapabilities(actionConfig *action.Configuration, log pkg.Logger) *chartutil.Capabilities {
+	if actionConfig.RESTClientGetter == nil {
+		return nil
+	}
+
+	dc, err := actionConfig.RESTClientGetter.ToDiscoveryClient()
+	if err != nil {
+		log.Debug("Could not get Kubernetes discovery client, using default capabilities: %v", err)
+		return nil
+	}
+
+	// force a discovery cache invalidation to always fetch the latest server version/capabilities.
+	dc.Invalidate()
+	kubeVersion, err := dc.ServerVersion()
+	if err != nil {
+		log.Debug("Could not get server version from Kubernetes, using default capabilities: %v", err)
+		return nil
+	}
+
+	apiVersions, err := action.GetVersionSet(dc)
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		log.Debug("Could not get apiVersions from Kubernetes, using default capabilities: %v", err)
+		return nil
+	}
+
+	return &chartutil.Capabilities{
+		APIVersions: apiVersions,
+		KubeVersion: chartutil.KubeVersion{
+			Version: kubeVersion.GitVersion,
+			Major:   kubeVersion.Major,
+			Minor:   kubeVersion.Minor,
+		},
+		HelmVersion: chartutil.DefaultCapabilities.HelmVersion,
+	}
+}
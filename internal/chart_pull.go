@@ -1,11 +1,13 @@
 ﻿package internal
 
 import (
+	"fmt"
 	"github.com/octopusdeploylabs/helm-migrate-values/pkg"
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/cli"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -56,3 +58,43 @@ func setupRegistryClient(client *action.Install, settings *cli.EnvSettings) erro
 
 	return err
 }
+
+// ChartRoot returns the directory containing the Chart.yaml of a located chart. Packaged charts are extracted into a
+// subdirectory named after the chart, so this may be a subdirectory of the located chart directory.
+func ChartRoot(chartDir string) (string, error) {
+	if _, err := os.Stat(filepath.Join(chartDir, chartutil.ChartfileName)); err == nil {
+		return chartDir, nil
+	}
+
+	entries, err := os.ReadDir(chartDir)
+	if err != nil {
+		return "", err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(chartDir, entry.Name(), chartutil.ChartfileName)); err == nil {
+			return filepath.Join(chartDir, entry.Name()), nil
+		}
+	}
+
+	return "", fmt.Errorf("no %s found in %s", chartutil.ChartfileName, chartDir)
+}
+
+// MigrationDir returns the path of the migration directory, which is relative to the chart's root. Packaged charts were
+// previously resolved relative to the directory they were extracted to, so a path that starts with the name of the
+// chart's directory, e.g. my-chart/value-migrations, is still accepted if the chart has no such directory.
+func MigrationDir(chartRoot string, migrationDir string) string {
+	dir := filepath.Join(chartRoot, migrationDir)
+	if _, err := os.Stat(dir); err == nil {
+		return dir
+	}
+
+	prefix := filepath.Base(chartRoot) + string(filepath.Separator)
+	if relative, ok := strings.CutPrefix(filepath.Clean(migrationDir), prefix); ok {
+		return filepath.Join(chartRoot, relative)
+	}
+	return dir
+}
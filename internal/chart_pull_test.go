@@ -0,0 +1,32 @@
+package internal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrationDir(t *testing.T) {
+	chartRoot := filepath.Join(t.TempDir(), "my-chart")
+	require.NoError(t, os.MkdirAll(filepath.Join(chartRoot, "value-migrations"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(chartRoot, "my-chart", "migrations"), 0755))
+
+	tests := []struct {
+		name         string
+		migrationDir string
+		expected     string
+	}{
+		{name: "relative to the chart root", migrationDir: "value-migrations", expected: filepath.Join(chartRoot, "value-migrations")},
+		{name: "starting with the chart's directory", migrationDir: "my-chart/value-migrations", expected: filepath.Join(chartRoot, "value-migrations")},
+		{name: "chart directory that exists in the chart", migrationDir: "my-chart/migrations", expected: filepath.Join(chartRoot, "my-chart", "migrations")},
+		{name: "missing directory", migrationDir: "other/value-migrations", expected: filepath.Join(chartRoot, "other", "value-migrations")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, MigrationDir(chartRoot, tt.migrationDir))
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"k8s.io/client-go/util/homedir"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // This is the same flags as https://github.com/helm/helm/blob/main/cmd/helm/flags.go#L54
@@ -31,3 +32,12 @@ func defaultKeyring() string {
 	}
 	return filepath.Join(homedir.HomeDir(), ".gnupg", "pubring.gpg")
 }
+
+// These are the upgrade flags from https://github.com/helm/helm/blob/main/cmd/helm/upgrade.go that apply to --apply
+func AddUpgradeFlags(f *pflag.FlagSet, u *action.Upgrade) {
+	f.BoolVar(&u.Wait, "wait", false, "if set with --apply, will wait until all Pods, PVCs, Services, and minimum number of Pods of a Deployment, StatefulSet, or ReplicaSet are in a ready state before marking the release as successful. It will wait for as long as --timeout")
+	f.DurationVar(&u.Timeout, "timeout", 300*time.Second, "time to wait for any individual Kubernetes operation (like Jobs for hooks) when used with --apply")
+	f.BoolVar(&u.Atomic, "atomic", false, "if set with --apply, the upgrade process rolls back changes made in case of failed upgrade. The --wait flag will be set automatically if --atomic is used")
+	f.StringVar(&u.DryRunOption, "dry-run", "", "if set with --apply, simulate the upgrade. If --dry-run is set with no option being specified or as '--dry-run=client', it will not attempt cluster connections. Setting '--dry-run=server' allows attempting cluster connections.")
+	f.Lookup("dry-run").NoOptDefVal = "client"
+}
@@ -1,25 +1,122 @@
 package internal
 
 import (
+	"cmp"
+	"github.com/octopusdeploylabs/helm-migrate-values/pkg"
 	"github.com/pkg/errors"
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
 	"slices"
 )
 
-func GetRelease(name string, listAction *action.List) (*release.Release, error) {
-	listAction.Deployed = true
-	listAction.SetStateMask()
-
-	releases, err := listAction.Run()
+// GetRelease gets the revision of the release to migrate. The latest revision of the release is looked up whatever its
+// status, and the values are taken from the last revision that was deployed, which is the latest revision unless,
+// for example, the latest upgrade failed. Unless allowPending is set, an error is returned if an operation on the
+// release is in progress, as its values may be about to change.
+func GetRelease(name string, historyAction *action.History, allowPending bool, log pkg.Logger) (*release.Release, error) {
+	history, err := historyAction.Run(name)
 	if err != nil {
+		if errors.Is(err, driver.ErrReleaseNotFound) {
+			return nil, errors.New("Could not find a Helm release matching the given release name.")
+		}
 		return nil, err
 	}
+	if len(history) == 0 {
+		return nil, errors.New("Could not find a Helm release matching the given release name.")
+	}
+
+	return selectRevision(name, history, allowPending, log)
+}
+
+// selectRevision selects the last revision that was deployed from the history of a release
+func selectRevision(name string, history []*release.Release, allowPending bool, log pkg.Logger) (*release.Release, error) {
+	slices.SortFunc(history, func(a, b *release.Release) int { return cmp.Compare(b.Version, a.Version) })
+	latest := history[0]
+	latestStatus := releaseStatus(latest)
+
+	if isInProgress(latestStatus) && !allowPending {
+		return nil, errors.Errorf("release %s has an operation in progress (revision %d is %s), so its values may be about to change. Wait for the operation to finish, or use --allow-pending to migrate the values of the last deployed revision anyway", name, latest.Version, latestStatus)
+	}
 
-	idx := slices.IndexFunc(releases, func(r *release.Release) bool { return r.Name == name })
+	idx := slices.IndexFunc(history, func(r *release.Release) bool {
+		status := releaseStatus(r)
+		return status == release.StatusDeployed || status == release.StatusSuperseded
+	})
 	if idx == -1 {
-		return nil, errors.New("Could not find a Helm release matching the given release name.")
+		return nil, errors.Errorf("release %s has no revision that was deployed (revision %d is %s), use --revision to migrate the values of a specific revision", name, latest.Version, latestStatus)
+	}
+
+	rel := history[idx]
+	if rel != latest {
+		log.Warning("The latest revision %d of release %s is %s, so the values are taken from revision %d (status: %s), the last revision that was deployed", latest.Version, name, latestStatus, rel.Version, releaseStatus(rel))
+	}
+	return rel, nil
+}
+
+func releaseStatus(r *release.Release) release.Status {
+	if r.Info == nil {
+		return release.StatusUnknown
+	}
+	return r.Info.Status
+}
+
+// isInProgress reports whether the status is that of an operation that has not finished
+func isInProgress(status release.Status) bool {
+	return status.IsPending() || status == release.StatusUninstalling
+}
+
+// ListReleasesForChart lists the releases that use the chart, ordered by namespace and name. The list action
+// determines the namespaces and label selector used. As with GetRelease, the values of each release are taken from its
+// last revision that was deployed, and a release that has an operation in progress, unless allowPending is set, or that
+// was never deployed is skipped with a warning.
+func ListReleasesForChart(chartName string, listAction *action.List, historyAction *action.History, allowPending bool, log pkg.Logger) ([]*release.Release, error) {
+	// The latest revision of each release is listed whatever its status, except for uninstalled releases
+	listAction.StateMask = action.ListAll &^ action.ListUninstalled
+
+	latest, err := listAction.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	var releases []*release.Release
+	for _, l := range latest {
+		history, err := historyAction.Run(l.Name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not get the history of release %s/%s", l.Namespace, l.Name)
+		}
+		// Releases with the same name in other namespaces are in the history when listing all namespaces
+		history = slices.DeleteFunc(history, func(r *release.Release) bool { return r.Namespace != l.Namespace })
+		if len(history) == 0 {
+			continue
+		}
+
+		rel, err := selectRevision(l.Namespace+"/"+l.Name, history, allowPending, log)
+		if err != nil {
+			log.Warning("Skipping release %s/%s: %v", l.Namespace, l.Name, err)
+			continue
+		}
+		if rel.Chart == nil || rel.Chart.Metadata == nil || rel.Chart.Metadata.Name != chartName {
+			continue
+		}
+		releases = append(releases, rel)
+	}
+
+	slices.SortFunc(releases, func(a, b *release.Release) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Name, b.Name))
+	})
+
+	return releases, nil
+}
+
+// GetReleaseRevision gets the revision of the release from its history, whatever the status of the revision
+func GetReleaseRevision(name string, revision int, getAction *action.Get) (*release.Release, error) {
+	getAction.Version = revision
+
+	rel, err := getAction.Run(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not find revision %d of release %s", revision, name)
 	}
 
-	return releases[idx], nil
+	return rel, nil
 }
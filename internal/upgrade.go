@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/octopusdeploylabs/helm-migrate-values/pkg"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/release"
+	"os"
+	"slices"
+)
+
+var dryRunOptions = []string{"", "none", "false", "true", "client", "server"}
+
+// UpgradeRelease upgrades the release to the chart, resetting the release's user-supplied values to the migrated values.
+func UpgradeRelease(name string, chrt *chart.Chart, migratedValues map[string]interface{}, upgradeAction *action.Upgrade, log pkg.Logger) (*release.Release, error) {
+	if !slices.Contains(dryRunOptions, upgradeAction.DryRunOption) {
+		return nil, fmt.Errorf("invalid dry-run flag. Flag must one of the following: false, true, client, server: %s", upgradeAction.DryRunOption)
+	}
+
+	// The migrated values are the complete set of user-supplied values for the new chart version, so the existing
+	// values are reset rather than merged.
+	upgradeAction.ResetThenReuseValues = true
+
+	log.Debug("Upgrading release %s to chart %s version %s", name, chrt.Name(), chrt.Metadata.Version)
+	rel, err := upgradeAction.Run(name, chrt, pkg.NormalizeValues(migratedValues))
+	if err != nil {
+		return nil, fmt.Errorf("failed to upgrade release %s: %w", name, err)
+	}
+
+	return rel, nil
+}
+
+// IsDryRun mirrors the (unexported) check the upgrade action uses to decide whether it is simulating the upgrade
+func IsDryRun(upgradeAction *action.Upgrade) bool {
+	switch upgradeAction.DryRunOption {
+	case "true", "client", "server":
+		return true
+	default:
+		return upgradeAction.DryRun
+	}
+}
+
+// NewUpgradeInNamespace creates an upgrade action for a release in the given namespace, with its own configuration so
+// that releases in different namespaces can be upgraded at the same time. The upgrade flags are copied from flags.
+func NewUpgradeInNamespace(settings *cli.EnvSettings, namespace string, flags *action.Upgrade, log pkg.Logger) (*action.Upgrade, error) {
+	actionConfig := new(action.Configuration)
+	if err := actionConfig.Init(settings.RESTClientGetter(), namespace, os.Getenv("HELM_DRIVER"), log.Debug); err != nil {
+		return nil, err
+	}
+	if kubeClient, ok := actionConfig.KubeClient.(*kube.Client); ok {
+		kubeClient.Namespace = namespace
+	}
+
+	upgradeAction := action.NewUpgrade(actionConfig)
+	upgradeAction.Namespace = namespace
+	upgradeAction.Wait = flags.Wait
+	upgradeAction.Timeout = flags.Timeout
+	upgradeAction.Atomic = flags.Atomic
+	upgradeAction.DryRunOption = flags.DryRunOption
+
+	return upgradeAction, nil
+}
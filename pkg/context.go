@@ -0,0 +1,163 @@
+package pkg
+
+import (
+	"fmt"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"strings"
+)
+
+// TemplateContextMode selects the data a migration template is executed with
+type TemplateContextMode string
+
+const (
+	// ValuesTemplateContext executes the template with the values being migrated as `.`, and any parameters as .Params.
+	// This is the default, so that existing migrations keep working.
+	ValuesTemplateContext TemplateContextMode = "values"
+	// FullTemplateContext executes the template with a TemplateContext, which describes the release and charts as well
+	// as the values, in the same way as a chart's templates.
+	FullTemplateContext TemplateContextMode = "full"
+)
+
+// MigrationEnvironment describes where values are being migrated, for migrations that use the full template context
+type MigrationEnvironment struct {
+	Release TemplateRelease
+	// FromChart is the chart the values are used with, which is nil if it is not known
+	FromChart *chart.Chart
+	// ToChart is the chart the values are migrated to
+	ToChart *chart.Chart
+	// Capabilities returns the capabilities of the cluster. It is only called when a migration uses the full template
+	// context, and chartutil.DefaultCapabilities are used if it is nil or returns nil.
+	Capabilities func() *chartutil.Capabilities
+}
+
+// TemplateContext is the data that migrations using the full template context are executed with, e.g.
+// {{ .Values.image.tag }}, {{ .Release.Namespace }} or {{ .ToChart.Version }}.
+type TemplateContext struct {
+	Values  map[string]interface{}
+	Params  map[string]interface{}
+	Release TemplateRelease
+	// FromChart is nil if the chart the values are used with is not known, e.g. when migrating a values file
+	FromChart *TemplateChart
+	ToChart   *TemplateChart
+	// Capabilities are those of the cluster, or Helm's defaults if the cluster is not used
+	Capabilities *chartutil.Capabilities
+	// Files are the files of the chart that defines the migration, which is the target chart for up migrations and
+	// the chart the values are from for down migrations
+	Files TemplateFiles
+}
+
+// TemplateRelease is the release whose values are being migrated
+type TemplateRelease struct {
+	Name      string
+	Namespace string
+	// Revision is the revision of the release the values are from, or 0 if the values are not from a release
+	Revision int
+}
+
+// TemplateChart describes a chart to migration templates. Like .Chart in a chart's templates, the fields of the
+// chart's metadata can be used, e.g. .ToChart.Version.
+type TemplateChart struct {
+	*chart.Metadata
+	// SchemaVersion is the version of the chart's values schema
+	SchemaVersion string
+	// Values are the chart's default values
+	Values map[string]interface{}
+}
+
+func newTemplateChart(c *chart.Chart) *TemplateChart {
+	if c == nil || c.Metadata == nil {
+		return nil
+	}
+
+	templateChart := &TemplateChart{Metadata: c.Metadata, Values: normalizeMap(c.Values)}
+	if version, err := SchemaVersion(c); err == nil {
+		templateChart.SchemaVersion = version.Original()
+	}
+	return templateChart
+}
+
+// TemplateFiles are the files of a chart, by their path within the chart, as in .Files of a chart's templates
+type TemplateFiles map[string][]byte
+
+func newTemplateFiles(c *chart.Chart) TemplateFiles {
+	files := make(TemplateFiles)
+	if c == nil {
+		return files
+	}
+	for _, file := range c.Files {
+		files[file.Name] = file.Data
+	}
+	return files
+}
+
+// Get returns the content of the file, or an empty string if there is no such file
+func (f TemplateFiles) Get(name string) string {
+	return string(f.GetBytes(name))
+}
+
+// GetBytes returns the content of the file, or nil if there is no such file
+func (f TemplateFiles) GetBytes(name string) []byte {
+	return f[name]
+}
+
+// Lines returns the lines of the file, or nil if there is no such file
+func (f TemplateFiles) Lines(name string) []string {
+	data, ok := f[name]
+	if !ok {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// newTemplateContext returns the full template context for the migration
+func newTemplateContext(values map[string]interface{}, params map[string]interface{}, m *Migration, env *MigrationEnvironment) *TemplateContext {
+	ctx := &TemplateContext{
+		Values:       values,
+		Params:       params,
+		Capabilities: chartutil.DefaultCapabilities,
+		Files:        newTemplateFiles(nil),
+	}
+	if ctx.Values == nil {
+		ctx.Values = map[string]interface{}{}
+	}
+	if ctx.Params == nil {
+		ctx.Params = map[string]interface{}{}
+	}
+	if env == nil {
+		return ctx
+	}
+
+	ctx.Release = env.Release
+	ctx.FromChart, ctx.ToChart = newTemplateChart(env.FromChart), newTemplateChart(env.ToChart)
+	if env.Capabilities != nil {
+		if caps := env.Capabilities(); caps != nil {
+			ctx.Capabilities = caps
+		}
+	}
+
+	// Down migrations are defined by the newer chart the values are migrated from
+	if m.Direction == Down {
+		ctx.Files = newTemplateFiles(env.FromChart)
+	} else {
+		ctx.Files = newTemplateFiles(env.ToChart)
+	}
+	return ctx
+}
+
+// templateContextMode returns the template context the migration is executed with
+func (m *MigrationMetadata) templateContextMode() TemplateContextMode {
+	if m == nil || m.TemplateContext == "" {
+		return ValuesTemplateContext
+	}
+	return m.TemplateContext
+}
+
+func validateTemplateContextMode(mode TemplateContextMode) error {
+	switch mode {
+	case "", ValuesTemplateContext, FullTemplateContext:
+		return nil
+	default:
+		return fmt.Errorf("unknown templateContext '%s', expected '%s' or '%s'", mode, ValuesTemplateContext, FullTemplateContext)
+	}
+}
@@ -0,0 +1,110 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"testing"
+)
+
+func TestMigrator_FullTemplateContext(t *testing.T) {
+	fromChart := testChart("my-chart", "1.0.0", map[string]string{"files/from.txt": "from"})
+	fromChart.Values = map[string]interface{}{"image": map[string]interface{}{"tag": "v1.0.0"}}
+	toChart := testChart("my-chart", "2.0.0", map[string]string{"files/to.txt": "to"})
+	toChart.Values = map[string]interface{}{"image": map[string]interface{}{"tag": "v2.0.0"}}
+	caps := &chartutil.Capabilities{KubeVersion: chartutil.KubeVersion{Version: "v1.30.1", Major: "1", Minor: "30"}}
+
+	mp := &MemoryMigrationProvider{}
+	mp.AddMigration(majorVersion(2), TemplateFormat, `release: {{ .Release.Name }}/{{ .Release.Namespace }}@{{ .Release.Revision }}
+charts: {{ .FromChart.Version }}->{{ .ToChart.Version }} ({{ .ToChart.SchemaVersion }})
+{{- if eq .Values.image.tag .FromChart.Values.image.tag }}
+image: {}
+{{- end }}
+kube: {{ .Capabilities.KubeVersion.Version }}
+file: {{ .Files.Get "files/to.txt" }}
+storage: {{ .Params.storageClass }}
+`)
+	mp.Migrations[0].Metadata = &MigrationMetadata{TemplateContext: FullTemplateContext, Params: []MigrationParam{{Name: "storageClass"}}}
+	mp.AddDownMigration(majorVersion(2), TemplateFormat, `file: {{ .Files.Get "files/from.txt" }}`)
+	mp.Migrations[1].Metadata = &MigrationMetadata{TemplateContext: FullTemplateContext}
+
+	mg := NewMigrator(mp, *NewLogger(false))
+	mg.Params = map[string]interface{}{"storageClass": "fast-ssd"}
+	mg.Environment = &MigrationEnvironment{
+		Release:      TemplateRelease{Name: "my-release", Namespace: "apps", Revision: 3},
+		FromChart:    fromChart,
+		ToChart:      toChart,
+		Capabilities: func() *chartutil.Capabilities { return caps },
+	}
+
+	// The image tag is the old chart's default, so it is reset to the new chart's default
+	result, err := mg.Migrate(map[string]interface{}{"image": map[string]interface{}{"tag": "v1.0.0"}}, majorVersion(1), majorVersion(2))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"release": "my-release/apps@3",
+		"charts":  "1.0.0->2.0.0 (2.0.0)",
+		"image":   map[string]interface{}{},
+		"kube":    "v1.30.1",
+		"file":    "to",
+		"storage": "fast-ssd",
+	}, NormalizeValues(result.Values))
+
+	// Down migrations read the files of the chart the values are from
+	result, err = mg.Migrate(map[string]interface{}{"image": "nginx"}, majorVersion(2), majorVersion(1))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"file": "from"}, NormalizeValues(result.Values))
+}
+
+func TestMigrator_FullTemplateContextWithoutEnvironment(t *testing.T) {
+	mp := &MemoryMigrationProvider{}
+	mp.AddMigration(majorVersion(2), TemplateFormat, `tag: {{ .Values.image.tag }}
+kube: {{ .Capabilities.KubeVersion.Version }}
+hasChart: {{ not (empty .ToChart) }}
+`)
+	mp.Migrations[0].Metadata = &MigrationMetadata{TemplateContext: FullTemplateContext}
+
+	result, err := NewMigrator(mp, *NewLogger(false)).Migrate(map[string]interface{}{"image": map[string]interface{}{"tag": "1.2"}}, majorVersion(1), majorVersion(2))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"tag":      1.2,
+		"kube":     chartutil.DefaultCapabilities.KubeVersion.Version,
+		"hasChart": false,
+	}, NormalizeValues(result.Values))
+}
+
+func TestMigrateSubcharts_FullTemplateContext(t *testing.T) {
+	fromChart := testChart("my-chart", "1.0.0", nil)
+	fromChart.AddDependency(testChart("database", "1.0.0", nil))
+	toChart := testChart("my-chart", "1.1.0", nil)
+	toChart.AddDependency(testChart("database", "2.0.0", map[string]string{
+		"value-migrations/to-v2.yaml":      "# migration-mode: merge\nmigratedBy: {{ .Release.Name }} {{ .FromChart.Name }} {{ .FromChart.Version }}->{{ .ToChart.Version }}\n",
+		"value-migrations/to-v2.meta.yaml": "templateContext: full\n",
+	}))
+
+	mg := NewMigrator(nil, *NewLogger(false))
+	mg.Environment = &MigrationEnvironment{Release: TemplateRelease{Name: "my-release"}, FromChart: fromChart, ToChart: toChart}
+
+	result, err := mg.MigrateSubcharts(map[string]interface{}{"database": map[string]interface{}{"user": "admin"}}, fromChart, toChart)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"database": map[string]interface{}{"user": "admin", "migratedBy": "my-release database 1.0.0->2.0.0"},
+	}, NormalizeValues(result.Values))
+}
+
+func TestParseMigrationMetadata_TemplateContext(t *testing.T) {
+	metadata, err := parseMigrationMetadata("templateContext: full\n")
+	require.NoError(t, err)
+	assert.Equal(t, FullTemplateContext, metadata.templateContextMode())
+
+	_, err = parseMigrationMetadata("templateContext: helm\n")
+	require.ErrorContains(t, err, "unknown templateContext 'helm', expected 'values' or 'full'")
+}
+
+func TestTemplateFiles(t *testing.T) {
+	files := newTemplateFiles(testChart("my-chart", "1.0.0", map[string]string{"config/hosts": "a\nb\n"}))
+
+	assert.Equal(t, "a\nb\n", files.Get("config/hosts"))
+	assert.Equal(t, []string{"a", "b"}, files.Lines("config/hosts"))
+	assert.Empty(t, files.Get("missing"))
+	assert.Nil(t, files.Lines("missing"))
+}
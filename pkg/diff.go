@@ -0,0 +1,203 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/pmezard/go-difflib/difflib"
+	"gopkg.in/yaml.v2"
+	"slices"
+	"strings"
+)
+
+// ValuesDiff is a semantic summary of the differences between two sets of values, addressed by dotted paths.
+type ValuesDiff struct {
+	Added   []ValueChange
+	Removed []ValueChange
+	Changed []ValueChange
+	// Moved lists values that were removed from one path and added, unchanged, at another path
+	Moved []ValueMove
+}
+
+type ValueChange struct {
+	Path     string
+	OldValue interface{}
+	NewValue interface{}
+}
+
+type ValueMove struct {
+	From  string
+	To    string
+	Value interface{}
+}
+
+// IsEmpty reports whether the values are semantically the same
+func (d ValuesDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 && len(d.Moved) == 0
+}
+
+// Paths returns every path that was added, removed, changed, or moved from or to
+func (d ValuesDiff) Paths() []string {
+	var paths []string
+	for _, changes := range [][]ValueChange{d.Added, d.Removed, d.Changed} {
+		for _, c := range changes {
+			paths = append(paths, c.Path)
+		}
+	}
+	for _, m := range d.Moved {
+		paths = append(paths, m.From, m.To)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// String formats the summary with one line per change
+func (d ValuesDiff) String() string {
+	if d.IsEmpty() {
+		return "No changes\n"
+	}
+
+	var sb strings.Builder
+	for _, c := range d.Added {
+		_, _ = fmt.Fprintf(&sb, "added:   %s = %s\n", c.Path, displayValue(c.NewValue))
+	}
+	for _, c := range d.Removed {
+		_, _ = fmt.Fprintf(&sb, "removed: %s (was %s)\n", c.Path, displayValue(c.OldValue))
+	}
+	for _, c := range d.Changed {
+		_, _ = fmt.Fprintf(&sb, "changed: %s from %s to %s\n", c.Path, displayValue(c.OldValue), displayValue(c.NewValue))
+	}
+	for _, m := range d.Moved {
+		_, _ = fmt.Fprintf(&sb, "moved:   %s -> %s\n", m.From, m.To)
+	}
+	return sb.String()
+}
+
+// DiffValues compares the values leaf by leaf, where lists, scalars and empty maps are treated as leaves. A value
+// that was removed from one path and appears unchanged at a new path is reported as moved.
+func DiffValues(from, to map[string]interface{}) ValuesDiff {
+	fromLeaves := flattenValues(normalizeMap(from))
+	toLeaves := flattenValues(normalizeMap(to))
+
+	var diff ValuesDiff
+	for _, p := range sortedKeys(fromLeaves) {
+		newValue, ok := toLeaves[p]
+		switch {
+		case !ok:
+			diff.Removed = append(diff.Removed, ValueChange{Path: p, OldValue: fromLeaves[p]})
+		case !valuesEqual(fromLeaves[p], newValue):
+			diff.Changed = append(diff.Changed, ValueChange{Path: p, OldValue: fromLeaves[p], NewValue: newValue})
+		}
+	}
+	for _, p := range sortedKeys(toLeaves) {
+		if _, ok := fromLeaves[p]; !ok {
+			diff.Added = append(diff.Added, ValueChange{Path: p, NewValue: toLeaves[p]})
+		}
+	}
+
+	diff.Removed = slices.DeleteFunc(diff.Removed, func(removed ValueChange) bool {
+		idx := findMoveTarget(removed, diff.Added)
+		if idx == -1 {
+			return false
+		}
+		diff.Moved = append(diff.Moved, ValueMove{From: removed.Path, To: diff.Added[idx].Path, Value: removed.OldValue})
+		diff.Added = slices.Delete(diff.Added, idx, idx+1)
+		return true
+	})
+
+	return diff
+}
+
+// findMoveTarget returns the index of the added value that the removed value most likely moved to, preferring the
+// path that shares the most trailing keys with the removed path, or -1 if the value was not added anywhere.
+func findMoveTarget(removed ValueChange, added []ValueChange) int {
+	candidate, candidateScore := -1, -1
+	for i, a := range added {
+		if !valuesEqual(removed.OldValue, a.NewValue) {
+			continue
+		}
+		if score := commonSuffixLength(removed.Path, a.Path); score > candidateScore {
+			candidate, candidateScore = i, score
+		}
+	}
+	return candidate
+}
+
+func commonSuffixLength(a, b string) int {
+	pathA, errA := parseValuePath(a)
+	pathB, errB := parseValuePath(b)
+	if errA != nil || errB != nil {
+		return 0
+	}
+
+	n := 0
+	for n < len(pathA) && n < len(pathB) && pathA[len(pathA)-1-n] == pathB[len(pathB)-1-n] {
+		n++
+	}
+	return n
+}
+
+func flattenValues(values map[string]interface{}) map[string]interface{} {
+	leaves := make(map[string]interface{})
+	var walk func(prefix valuePath, value interface{})
+	walk = func(prefix valuePath, value interface{}) {
+		m, ok := value.(map[string]interface{})
+		if !ok || (len(m) == 0 && len(prefix) > 0) {
+			leaves[prefix.String()] = value
+			return
+		}
+		for key, item := range m {
+			walk(append(slices.Clone(prefix), key), item)
+		}
+	}
+	walk(nil, values)
+	delete(leaves, "")
+	return leaves
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// UnifiedDiff returns a unified diff of the YAML representation of the values, or an empty string if they are the same.
+func UnifiedDiff(from, to map[string]interface{}, fromName, toName string) (string, error) {
+	fromYaml, err := valuesYaml(from)
+	if err != nil {
+		return "", err
+	}
+	toYaml, err := valuesYaml(to)
+	if err != nil {
+		return "", err
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(fromYaml),
+		B:        splitLines(toYaml),
+		FromFile: fromName,
+		ToFile:   toName,
+		Context:  3,
+	})
+}
+
+func valuesYaml(values map[string]interface{}) (string, error) {
+	if len(values) == 0 {
+		return "", nil
+	}
+
+	data, err := yaml.Marshal(normalizeMap(values))
+	if err != nil {
+		return "", fmt.Errorf("error formatting values as yaml: %w", err)
+	}
+	return string(data), nil
+}
+
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
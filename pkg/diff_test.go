@@ -0,0 +1,87 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDiff_DiffValues(t *testing.T) {
+	from := map[string]interface{}{
+		"replicas": float64(1),
+		"legacy":   true,
+		"agent": map[interface{}]interface{}{
+			"targetEnvironments": []interface{}{"test"},
+			"name":               "my-agent",
+		},
+		"unchanged": "value",
+	}
+	to := map[string]interface{}{
+		"replicas": 3,
+		"agent": map[string]interface{}{
+			"target": map[string]interface{}{
+				"environments": []interface{}{"test"},
+			},
+			"name":   "my-agent",
+			"labels": map[string]interface{}{},
+		},
+		"unchanged": "value",
+	}
+
+	diff := DiffValues(from, to)
+
+	assert.Equal(t, []ValueChange{{Path: "agent.labels", NewValue: map[string]interface{}{}}}, diff.Added)
+	assert.Equal(t, []ValueChange{{Path: "legacy", OldValue: true}}, diff.Removed)
+	assert.Equal(t, []ValueChange{{Path: "replicas", OldValue: float64(1), NewValue: 3}}, diff.Changed)
+	assert.Equal(t, []ValueMove{{From: "agent.targetEnvironments", To: "agent.target.environments", Value: []interface{}{"test"}}}, diff.Moved)
+
+	assert.Equal(t, `added:   agent.labels = {}
+removed: legacy (was true)
+changed: replicas from 1 to 3
+moved:   agent.targetEnvironments -> agent.target.environments
+`, diff.String())
+}
+
+func TestDiff_MovePrefersMatchingKey(t *testing.T) {
+	from := map[string]interface{}{
+		"service": map[string]interface{}{"enabled": true},
+	}
+	to := map[string]interface{}{
+		"metrics":    map[string]interface{}{"enabled": true},
+		"networking": map[string]interface{}{"service": map[string]interface{}{"enabled": true}},
+	}
+
+	diff := DiffValues(from, to)
+
+	require.Len(t, diff.Moved, 1)
+	assert.Equal(t, "networking.service.enabled", diff.Moved[0].To)
+	assert.Equal(t, []ValueChange{{Path: "metrics.enabled", NewValue: true}}, diff.Added)
+}
+
+func TestDiff_UnifiedDiff(t *testing.T) {
+	from := map[string]interface{}{
+		"agent": map[string]interface{}{"targetEnvironment": "test"},
+		"name":  "my-agent",
+	}
+	to := map[string]interface{}{
+		"agent": map[interface{}]interface{}{"targetEnvironments": []interface{}{"test"}},
+		"name":  "my-agent",
+	}
+
+	diff, err := UnifiedDiff(from, to, "current", "migrated")
+	require.NoError(t, err)
+
+	assert.Equal(t, `--- current
++++ migrated
+@@ -1,3 +1,4 @@
+ agent:
+-  targetEnvironment: test
++  targetEnvironments:
++  - test
+ name: my-agent
+`, diff)
+
+	same, err := UnifiedDiff(from, from, "current", "migrated")
+	require.NoError(t, err)
+	assert.Empty(t, same)
+}
@@ -0,0 +1,314 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"slices"
+)
+
+// The indentation used when it cannot be detected from the document
+const defaultDocumentIndent = 2
+
+// ValuesDocument is a YAML values file that can be updated with migrated values. Unlike marshalling the values, keys
+// that were not changed keep their comments, order, anchors and formatting, and only the migrated paths are rewritten.
+type ValuesDocument struct {
+	root   *yaml.Node
+	indent int
+}
+
+// ReadValuesDocument reads a YAML or JSON values file, such as one captured with helm get values, whose header is
+// ignored.
+func ReadValuesDocument(r io.Reader) (*ValuesDocument, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading values: %w", err)
+	}
+
+	return ParseValuesDocument(trimHelmGetValuesHeader(data))
+}
+
+// ParseValuesDocument parses a YAML or JSON values file. An empty file, or one with only null values, has no values.
+func ParseValuesDocument(data []byte) (*ValuesDocument, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("error parsing values: %w", err)
+	}
+
+	if root.Kind == 0 {
+		root = yaml.Node{Kind: yaml.DocumentNode}
+	}
+	if len(root.Content) == 0 || isNullNode(root.Content[0]) {
+		root.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+	if root.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("error parsing values: expected a map of values, found a %s", root.Content[0].Tag)
+	}
+
+	return &ValuesDocument{root: &root, indent: detectIndent(root.Content[0])}, nil
+}
+
+// Values returns the values in the document
+func (d *ValuesDocument) Values() (map[string]interface{}, error) {
+	var values map[string]interface{}
+	if err := d.root.Decode(&values); err != nil {
+		return nil, fmt.Errorf("error decoding values: %w", err)
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return NormalizeValues(values), nil
+}
+
+// Update rewrites the document to contain the values. Keys that are in both the document and the values keep their
+// position and comments, keys that are no longer in the values are removed, and new keys are added after the existing
+// keys of their map. A value that was moved to a new path keeps its comments and formatting.
+func (d *ValuesDocument) Update(values map[string]interface{}) error {
+	current, err := d.Values()
+	if err != nil {
+		return err
+	}
+	values = normalizeMap(values)
+
+	// Find the nodes of moved values before any are removed from the document
+	moved := make(map[string]documentEntry)
+	for _, move := range DiffValues(current, values).Moved {
+		if entry, ok := lookupEntry(d.root.Content[0], move.From); ok {
+			moved[move.To] = entry
+		}
+	}
+
+	u := &documentUpdater{moved: moved}
+	updated, err := u.update(nil, d.root.Content[0], values)
+	if err != nil {
+		return err
+	}
+	d.root.Content[0] = updated
+	expandDanglingAliases(d.root, make(map[*yaml.Node]bool))
+	return nil
+}
+
+// Bytes formats the document as YAML, using the indentation of the original document
+func (d *ValuesDocument) Bytes() ([]byte, error) {
+	if len(d.root.Content[0].Content) == 0 && d.root.HeadComment == "" && d.root.FootComment == "" {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(d.indent)
+	if err := encoder.Encode(d.root); err != nil {
+		return nil, fmt.Errorf("error formatting values as yaml: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("error formatting values as yaml: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// documentEntry is a key of a mapping node and its value
+type documentEntry struct {
+	key   *yaml.Node
+	value *yaml.Node
+}
+
+type documentUpdater struct {
+	// moved holds the original entries of moved values, by the path they were moved to
+	moved map[string]documentEntry
+}
+
+// update returns the node for the value at the path, reusing the existing node, or the parts of it, that are unchanged
+func (u *documentUpdater) update(p valuePath, node *yaml.Node, value interface{}) (*yaml.Node, error) {
+	if node.Kind != yaml.AliasNode {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if node.Kind == yaml.MappingNode && !hasMergeKey(node) {
+				return u.updateMapping(p, node, v)
+			}
+		case []interface{}:
+			if node.Kind == yaml.SequenceNode && len(node.Content) == len(v) {
+				for i, item := range v {
+					updated, err := u.update(append(slices.Clone(p), fmt.Sprint(i)), node.Content[i], item)
+					if err != nil {
+						return nil, err
+					}
+					node.Content[i] = updated
+				}
+				return node, nil
+			}
+		}
+	}
+
+	var existing interface{}
+	if err := node.Decode(&existing); err == nil && valuesEqual(existing, value) {
+		return node, nil
+	}
+
+	replacement, err := u.build(p, value)
+	if err != nil {
+		return nil, err
+	}
+	// A changed scalar keeps its comments, e.g. "replicas: 2 # the number of pods"
+	if replacement.Kind == yaml.ScalarNode && node.Kind == yaml.ScalarNode {
+		replacement.HeadComment, replacement.LineComment, replacement.FootComment = node.HeadComment, node.LineComment, node.FootComment
+	}
+	return replacement, nil
+}
+
+func (u *documentUpdater) updateMapping(p valuePath, node *yaml.Node, values map[string]interface{}) (*yaml.Node, error) {
+	content := make([]*yaml.Node, 0, len(node.Content))
+	existing := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		value, ok := values[key]
+		if !ok {
+			continue
+		}
+		existing[key] = true
+		updated, err := u.update(append(slices.Clone(p), key), node.Content[i+1], value)
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, node.Content[i], updated)
+	}
+
+	for _, key := range sortedKeys(values) {
+		if existing[key] {
+			continue
+		}
+		keyNode, valueNode, err := u.buildEntry(append(slices.Clone(p), key), values[key])
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, keyNode, valueNode)
+	}
+
+	node.Content = content
+	return node, nil
+}
+
+// buildEntry returns a new key and value for the path, reusing the original nodes of a moved value
+func (u *documentUpdater) buildEntry(p valuePath, value interface{}) (*yaml.Node, *yaml.Node, error) {
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: p.last()}
+	if entry, ok := u.moved[p.String()]; ok {
+		key.HeadComment, key.LineComment, key.FootComment = entry.key.HeadComment, entry.key.LineComment, entry.key.FootComment
+		return key, entry.value, nil
+	}
+
+	node, err := u.build(p, value)
+	return key, node, err
+}
+
+func (u *documentUpdater) build(p valuePath, value interface{}) (*yaml.Node, error) {
+	if m, ok := value.(map[string]interface{}); ok && len(m) > 0 {
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, key := range sortedKeys(m) {
+			keyNode, valueNode, err := u.buildEntry(append(slices.Clone(p), key), m[key])
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, keyNode, valueNode)
+		}
+		return node, nil
+	}
+
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return nil, fmt.Errorf("error formatting value at %s as yaml: %w", p, err)
+	}
+	return &node, nil
+}
+
+// lookupEntry finds the key and value nodes at the dotted path, following only mapping nodes
+func lookupEntry(node *yaml.Node, path string) (documentEntry, bool) {
+	p, err := parseValuePath(path)
+	if err != nil {
+		return documentEntry{}, false
+	}
+
+	var entry documentEntry
+	for _, key := range p {
+		if node.Kind != yaml.MappingNode {
+			return documentEntry{}, false
+		}
+		found := false
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				entry = documentEntry{key: node.Content[i], value: node.Content[i+1]}
+				node, found = node.Content[i+1], true
+				break
+			}
+		}
+		if !found {
+			return documentEntry{}, false
+		}
+	}
+	return entry, true
+}
+
+// expandDanglingAliases replaces each alias whose anchor is no longer defined before it with a copy of the aliased value
+func expandDanglingAliases(node *yaml.Node, anchors map[*yaml.Node]bool) {
+	if node.Kind == yaml.AliasNode && !anchors[node.Alias] {
+		*node = *copyNode(node.Alias)
+	}
+	if node.Anchor != "" {
+		anchors[node] = true
+	}
+	for _, child := range node.Content {
+		expandDanglingAliases(child, anchors)
+	}
+}
+
+func copyNode(node *yaml.Node) *yaml.Node {
+	if node.Kind == yaml.AliasNode {
+		return copyNode(node.Alias)
+	}
+
+	// The copy is not anchored, as aliases refer to the original node
+	c := *node
+	c.Anchor = ""
+	c.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		c.Content[i] = copyNode(child)
+	}
+	return &c
+}
+
+func hasMergeKey(node *yaml.Node) bool {
+	for i := 0; i < len(node.Content); i += 2 {
+		if node.Content[i].Tag == "!!merge" {
+			return true
+		}
+	}
+	return false
+}
+
+func isNullNode(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
+
+// detectIndent returns the number of spaces that nested maps are indented by in the document
+func detectIndent(node *yaml.Node) int {
+	if indent := findIndent(node); indent > 0 {
+		return indent
+	}
+	return defaultDocumentIndent
+}
+
+// findIndent returns the indentation of the first nested block map, or 0 if there is none
+func findIndent(node *yaml.Node) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if value.Kind != yaml.MappingNode || value.Style&yaml.FlowStyle != 0 || len(value.Content) == 0 {
+			continue
+		}
+		if indent := value.Content[0].Column - key.Column; indent > 0 {
+			return indent
+		}
+		if indent := findIndent(value); indent > 0 {
+			return indent
+		}
+	}
+	return 0
+}
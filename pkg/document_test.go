@@ -0,0 +1,178 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestValuesDocument_Update(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		values   map[string]interface{}
+		expected string
+	}{
+		{
+			name: "keeps comments and order of unchanged keys",
+			input: `# The agent's settings
+agent:
+  name: my-agent # the display name
+  # The number of replicas
+  replicas: 1
+image: octopus
+`,
+			values: map[string]interface{}{
+				"agent": map[string]interface{}{"name": "my-agent", "replicas": 2},
+				"image": "octopus",
+			},
+			expected: `# The agent's settings
+agent:
+  name: my-agent # the display name
+  # The number of replicas
+  replicas: 2
+image: octopus
+`,
+		},
+		{
+			name: "removes keys and appends new keys",
+			input: `zebra: 1
+# Removed
+old: true
+apple: 2
+`,
+			values: map[string]interface{}{
+				"zebra": 1,
+				"apple": 2,
+				"new":   map[string]interface{}{"b": "x", "a": "w"},
+			},
+			expected: `zebra: 1
+apple: 2
+new:
+  a: w
+  b: x
+`,
+		},
+		{
+			name: "moved value keeps its comments and style",
+			input: `project:
+  # Environments to deploy to
+  targetEnvironments: [Development, Test] # in order
+  name: 'my project'
+`,
+			values: map[string]interface{}{
+				"project": map[string]interface{}{
+					"name": "my project",
+					"deploymentTarget": map[string]interface{}{
+						"initial": map[string]interface{}{"environments": []interface{}{"Development", "Test"}},
+					},
+				},
+			},
+			expected: `project:
+  name: 'my project'
+  deploymentTarget:
+    initial:
+      # Environments to deploy to
+      environments: [Development, Test] # in order
+`,
+		},
+		{
+			name: "keeps the document's indentation",
+			input: `agent:
+    name: my-agent
+`,
+			values: map[string]interface{}{
+				"agent": map[string]interface{}{"name": "my-agent", "target": map[string]interface{}{"replicas": 1}},
+			},
+			expected: `agent:
+    name: my-agent
+    target:
+        replicas: 1
+`,
+		},
+		{
+			name: "updates lists item by item",
+			input: `hosts:
+  - a.example.com # primary
+  - b.example.com
+`,
+			values: map[string]interface{}{
+				"hosts": []interface{}{"a.example.com", "c.example.com"},
+			},
+			expected: `hosts:
+  - a.example.com # primary
+  - c.example.com
+`,
+		},
+		{
+			name: "expands aliases of removed anchors",
+			input: `defaults: &defaults
+  replicas: 1
+agent: *defaults
+`,
+			values: map[string]interface{}{
+				"agent": map[string]interface{}{"replicas": 1},
+			},
+			expected: `agent:
+  replicas: 1
+`,
+		},
+		{
+			name: "keeps anchors that are still defined",
+			input: `defaults: &defaults
+  replicas: 1
+agent: *defaults
+`,
+			values: map[string]interface{}{
+				"defaults": map[string]interface{}{"replicas": 1},
+				"agent":    map[string]interface{}{"replicas": 1},
+			},
+			expected: `defaults: &defaults
+  replicas: 1
+agent: *defaults
+`,
+		},
+		{
+			name:  "empty document",
+			input: "",
+			values: map[string]interface{}{
+				"agent": map[string]interface{}{"name": "my-agent"},
+			},
+			expected: `agent:
+  name: my-agent
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ParseValuesDocument([]byte(tt.input))
+			require.NoError(t, err)
+
+			require.NoError(t, doc.Update(tt.values))
+
+			actual, err := doc.Bytes()
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(actual))
+
+			values, err := doc.Values()
+			require.NoError(t, err)
+			assert.Equal(t, NormalizeValues(tt.values), values)
+		})
+	}
+}
+
+func TestReadValuesDocument(t *testing.T) {
+	doc, err := ReadValuesDocument(strings.NewReader("USER-SUPPLIED VALUES:\nagent:\n  name: my-agent\n"))
+	require.NoError(t, err)
+
+	values, err := doc.Values()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"agent": map[string]interface{}{"name": "my-agent"}}, values)
+}
+
+func TestParseValuesDocument_Invalid(t *testing.T) {
+	_, err := ParseValuesDocument([]byte("- a list\n"))
+	require.ErrorContains(t, err, "expected a map of values")
+}
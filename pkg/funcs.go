@@ -0,0 +1,132 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+	"strings"
+	"text/template"
+)
+
+// The functions in this file are modified from those Helm adds to chart templates, so that migrations can be written
+// in the same way as a chart's templates:
+// https://github.com/helm/helm/blob/2feac15cc3252c97c997be2ced1ab8afe314b429/pkg/engine/funcs.go
+
+// The number of times a template can include itself, to stop recursive includes
+const includeRecursionLimit = 1000
+
+// fromYaml parses a YAML map. As in Helm, an error is returned in the map's Error key, rather than failing the template.
+func fromYaml(str string) map[string]interface{} {
+	m := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(str), &m); err != nil {
+		m["Error"] = err.Error()
+	}
+	return normalizeMap(m)
+}
+
+// fromYamlArray parses a YAML list. As in Helm, an error is returned as the only item of the list.
+func fromYamlArray(str string) []interface{} {
+	var a []interface{}
+	if err := yaml.Unmarshal([]byte(str), &a); err != nil {
+		return []interface{}{err.Error()}
+	}
+	for i, item := range a {
+		a[i] = normalizeValue(item)
+	}
+	return a
+}
+
+func toJson(v interface{}) string {
+	data, err := json.Marshal(normalizeValue(v))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// fromJson parses a JSON object. As in Helm, an error is returned in the map's Error key, rather than failing the
+// template.
+func fromJson(str string) map[string]interface{} {
+	m := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(str), &m); err != nil {
+		m["Error"] = err.Error()
+	}
+	return m
+}
+
+// fromJsonArray parses a JSON array. As in Helm, an error is returned as the only item of the list.
+func fromJsonArray(str string) []interface{} {
+	var a []interface{}
+	if err := json.Unmarshal([]byte(str), &a); err != nil {
+		return []interface{}{err.Error()}
+	}
+	return a
+}
+
+func toToml(v interface{}) string {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(normalizeValue(v)); err != nil {
+		return err.Error()
+	}
+	return buf.String()
+}
+
+// required fails the template with the message if the value is nil or an empty string
+func required(message string, value interface{}) (interface{}, error) {
+	if value == nil {
+		return value, errors.New(message)
+	}
+	if s, ok := value.(string); ok && s == "" {
+		return value, errors.New(message)
+	}
+	return value, nil
+}
+
+// includeFunc returns the include function, which executes a template defined in t, such as a partial from
+// _helpers.tpl, and returns the result so that it can be piped to other functions
+func includeFunc(t *template.Template, includedNames map[string]int) func(string, interface{}) (string, error) {
+	return func(name string, data interface{}) (string, error) {
+		if includedNames[name] > includeRecursionLimit {
+			return "", fmt.Errorf("unable to execute template: rendering template has a nested reference name: %s", name)
+		}
+		includedNames[name]++
+		defer func() { includedNames[name]-- }()
+
+		var buf strings.Builder
+		err := t.ExecuteTemplate(&buf, name, data)
+		return buf.String(), err
+	}
+}
+
+// tplFunc returns the tpl function, which executes a string as a template, e.g. one read from the values. The string
+// can use the templates defined in t, and define its own.
+func tplFunc(t *template.Template, includedNames map[string]int) func(string, interface{}) (string, error) {
+	return func(text string, data interface{}) (string, error) {
+		clone, err := t.Clone()
+		if err != nil {
+			return "", fmt.Errorf("cannot clone template: %w", err)
+		}
+
+		// The functions are bound to the clone, so that templates the string defines can be included
+		clone.Funcs(template.FuncMap{
+			"include": includeFunc(clone, includedNames),
+			"tpl":     tplFunc(clone, includedNames),
+		})
+
+		parsed, err := clone.New("tpl").Parse(text)
+		if err != nil {
+			return "", fmt.Errorf("cannot parse template %q: %w", text, err)
+		}
+
+		var buf strings.Builder
+		if err = parsed.Execute(&buf, data); err != nil {
+			return "", fmt.Errorf("error during tpl function execution for %q: %w", text, err)
+		}
+
+		// As in Helm, missing values are rendered as empty strings
+		return strings.ReplaceAll(buf.String(), "<no value>", ""), nil
+	}
+}
@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	"strings"
+	"testing"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	values := map[string]interface{}{
+		"name":     "my-agent",
+		"config":   "port: 8080\nhost: localhost\n",
+		"json":     `{"port": 8080}`,
+		"list":     "- a\n- b\n",
+		"greeting": "Hello {{ .name }}",
+		"tags":     map[string]interface{}{"env": "prod"},
+	}
+
+	tests := []struct {
+		name        string
+		template    string
+		expected    string
+		expectedErr string
+	}{
+		{name: "toJson", template: `{{ toJson .tags }}`, expected: `{"env":"prod"}`},
+		{name: "fromYaml", template: `{{ (fromYaml .config).host }}`, expected: "localhost"},
+		{name: "fromYaml nested map", template: `{{ dig "a" "b" "" (fromYaml "a:\n  b: c\n") }}`, expected: "c"},
+		{name: "fromYaml error", template: `{{ (fromYaml "- a").Error }}`, expected: "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!seq into map[string]interface {}"},
+		{name: "fromYamlArray", template: `{{ index (fromYamlArray .list) 1 }}`, expected: "b"},
+		{name: "fromJson", template: `{{ (fromJson .json).port }}`, expected: "8080"},
+		{name: "fromJsonArray", template: `{{ len (fromJsonArray "[1, 2]") }}`, expected: "2"},
+		{name: "toToml", template: `{{ toToml .tags }}`, expected: "env = \"prod\"\n"},
+		{name: "required", template: `{{ required "name is required" .name }}`, expected: "my-agent"},
+		{name: "required missing", template: `{{ required "id is required" .id }}`, expectedErr: "id is required"},
+		{name: "required empty", template: `{{ required "id is required" "" }}`, expectedErr: "id is required"},
+		{name: "fail", template: `{{ fail "not supported" }}`, expectedErr: "not supported"},
+		{name: "tpl", template: `{{ tpl .greeting . }}`, expected: "Hello my-agent"},
+		{name: "tpl missing value", template: `{{ tpl "[{{ .missing }}]" . }}`, expected: "[]"},
+		{name: "tpl with define", template: `{{ tpl "{{ define \"x\" }}x{{ end }}{{ include \"x\" . }}" . }}`, expected: "x"},
+		{name: "include", template: `{{ define "upper" }}{{ .name | upper }}{{ end }}{{ include "upper" . | lower }}`, expected: "my-agent"},
+		{name: "recursive include", template: `{{ define "loop" }}{{ include "loop" . }}{{ end }}{{ include "loop" . }}`, expectedErr: "rendering template has a nested reference name: loop"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseMigrationTemplate(tt.template, "")
+			require.NoError(t, err)
+
+			var sb strings.Builder
+			err = tmpl.Execute(&sb, values)
+			if tt.expectedErr != "" {
+				require.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, sb.String())
+		})
+	}
+}
+
+func TestMigrator_Helpers(t *testing.T) {
+	files := []*chart.File{
+		{Name: "value-migrations/_helpers.tpl", Data: []byte(`{{- define "environments" -}}
+{{- if .agent.targetEnvironment }}[{{ .agent.targetEnvironment | quote }}]{{ else }}[]{{ end -}}
+{{- end -}}
+`)},
+		{Name: "value-migrations/to-v2.yaml", Data: []byte("# migration-mode: merge\nagent:\n  targetEnvironments: {{ include \"environments\" . }}\n  targetEnvironment: null\n")},
+		{Name: "value-migrations/from-v2.yaml", Data: []byte("# migration-mode: merge\nagent:\n  targetEnvironment: {{ first .agent.targetEnvironments | quote }}\n  targetEnvironments: null\n")},
+	}
+	mp, err := NewChartFilesMigrationProvider(files, "value-migrations")
+	require.NoError(t, err)
+
+	values := map[string]interface{}{"agent": map[string]interface{}{"targetEnvironment": "test"}}
+	upgraded, err := Migrate(values, majorVersion(1), majorVersion(2), mp, *NewLogger(false))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"agent": map[string]interface{}{"targetEnvironments": []interface{}{"test"}}}, NormalizeValues(upgraded))
+
+	downgraded, err := Migrate(upgraded, majorVersion(2), majorVersion(1), mp, *NewLogger(false))
+	require.NoError(t, err)
+	assert.Equal(t, values, NormalizeValues(downgraded))
+}
@@ -0,0 +1,190 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// MigrationTestsDir is the directory, within the migrations directory, that holds the migration test fixtures.
+	// Each fixture is a directory containing input.yaml, from-version and expected.yaml, and optionally to-version and
+	// params.yaml.
+	MigrationTestsDir = "tests"
+
+	testInputFile       = "input.yaml"
+	testExpectedFile    = "expected.yaml"
+	testFromVersionFile = "from-version"
+	testToVersionFile   = "to-version"
+	testParamsFile      = "params.yaml"
+)
+
+// MigrationTest is a fixture that migrates the input values from a version and compares them with the expected values
+type MigrationTest struct {
+	Name        string
+	Dir         string
+	Input       map[string]interface{}
+	FromVersion *semver.Version
+	// ToVersion is nil if the fixture migrates to the chart's version
+	ToVersion *semver.Version
+	// Expected is nil if the fixture has no expected.yaml yet
+	Expected map[string]interface{}
+	// Params are the values of the migration parameters, by name
+	Params map[string]interface{}
+}
+
+type MigrationTestResult struct {
+	Test   MigrationTest
+	Actual map[string]interface{}
+	Err    error
+}
+
+func (r MigrationTestResult) Passed() bool {
+	return r.Err == nil && r.Test.Expected != nil && valuesEqual(r.Test.Expected, r.Actual)
+}
+
+// UpdateExpected saves the actual migrated values as the fixture's expected values
+func (r MigrationTestResult) UpdateExpected() error {
+	data, err := yaml.Marshal(normalizeMap(r.Actual))
+	if err != nil {
+		return fmt.Errorf("error formatting migrated values for test %s: %w", r.Test.Name, err)
+	}
+
+	if err = os.WriteFile(filepath.Join(r.Test.Dir, testExpectedFile), data, 0644); err != nil {
+		return fmt.Errorf("error updating expected values for test %s: %w", r.Test.Name, err)
+	}
+	return nil
+}
+
+// LoadMigrationTests loads the fixtures from the tests directory within the migrations directory
+func LoadMigrationTests(migrationsDir string) ([]MigrationTest, error) {
+	testsDir := filepath.Join(migrationsDir, MigrationTestsDir)
+	entries, err := os.ReadDir(testsDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading migration tests directory: %w", err)
+	}
+
+	var tests []MigrationTest
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		test, err := loadMigrationTest(entry.Name(), filepath.Join(testsDir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error loading migration test %s: %w", entry.Name(), err)
+		}
+		tests = append(tests, *test)
+	}
+
+	return tests, nil
+}
+
+func loadMigrationTest(name string, dir string) (*MigrationTest, error) {
+	test := &MigrationTest{Name: name, Dir: dir}
+
+	input, err := readValuesFile(filepath.Join(dir, testInputFile))
+	if err != nil {
+		return nil, err
+	}
+	test.Input = input
+
+	if test.FromVersion, err = readVersionFile(filepath.Join(dir, testFromVersionFile)); err != nil {
+		return nil, err
+	}
+	if test.FromVersion == nil {
+		return nil, fmt.Errorf("missing %s", testFromVersionFile)
+	}
+
+	if test.ToVersion, err = readVersionFile(filepath.Join(dir, testToVersionFile)); err != nil {
+		return nil, err
+	}
+
+	params, err := readValuesFile(filepath.Join(dir, testParamsFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	test.Params = params
+
+	expected, err := readValuesFile(filepath.Join(dir, testExpectedFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		test.Expected = expected
+		if test.Expected == nil {
+			test.Expected = map[string]interface{}{}
+		}
+	}
+
+	return test, nil
+}
+
+// RunMigrationTests runs every fixture against the migrations in the directory. toVersion is the version fixtures
+// migrate to unless they specify a to-version.
+func RunMigrationTests(migrationsDir string, toVersion *semver.Version, log Logger) ([]MigrationTestResult, error) {
+	tests, err := LoadMigrationTests(migrationsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	mp, err := NewFileSystemMigrationProvider(migrationsDir)
+	if err != nil {
+		return nil, fmt.Errorf("error creating migration provider: %w", err)
+	}
+
+	results := make([]MigrationTestResult, 0, len(tests))
+	for _, test := range tests {
+		vTo := toVersion
+		if test.ToVersion != nil {
+			vTo = test.ToVersion
+		}
+
+		log.Debug("running migration test %s from version %s to %s", test.Name, test.FromVersion, vTo)
+		// Fixtures are never prompted for parameters, so that the tests can run in CI
+		var actual map[string]interface{}
+		result, err := (&Migrator{Provider: mp, Log: log, Params: test.Params}).Migrate(test.Input, test.FromVersion, vTo)
+		if result != nil {
+			actual = result.Values
+		}
+		results = append(results, MigrationTestResult{Test: test, Actual: NormalizeValues(actual), Err: err})
+	}
+
+	return results, nil
+}
+
+func readValuesFile(p string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]interface{}
+	if err = yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", filepath.Base(p), err)
+	}
+	return values, nil
+}
+
+func readVersionFile(p string) (*semver.Version, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	version, err := semver.NewVersion(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", filepath.Base(p), err)
+	}
+	return version, nil
+}
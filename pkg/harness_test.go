@@ -0,0 +1,109 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHarness_ChartFixtures(t *testing.T) {
+	results, err := RunMigrationTests("test-charts/v2/value-migrations", majorVersion(2), *NewLogger(false))
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	assert.Equal(t, "move-environments", results[0].Test.Name)
+	assert.True(t, results[0].Passed())
+}
+
+func TestHarness_FailingFixtureAndUpdate(t *testing.T) {
+	req := require.New(t)
+
+	dir := t.TempDir()
+	writeMigrationFile(t, dir, "to-v2.ops.yaml", `
+- op: renameKey
+  path: agent.targetEnvironment
+  to: targetEnvironments
+`)
+	writeMigrationFile(t, dir, "to-v3.ops.yaml", `
+- op: toList
+  path: agent.targetEnvironments
+`)
+
+	fixtureDir := filepath.Join(dir, MigrationTestsDir, "rename")
+	req.NoError(os.MkdirAll(fixtureDir, 0755))
+	writeMigrationFile(t, fixtureDir, "input.yaml", "agent:\n  targetEnvironment: test\n")
+	writeMigrationFile(t, fixtureDir, "from-version", "1.2.0\n")
+	writeMigrationFile(t, fixtureDir, "to-version", "2.0.0\n")
+	writeMigrationFile(t, fixtureDir, "expected.yaml", "agent:\n  targetEnvironments: [test]\n")
+
+	missingDir := filepath.Join(dir, MigrationTestsDir, "no-expected-values")
+	req.NoError(os.MkdirAll(missingDir, 0755))
+	writeMigrationFile(t, missingDir, "input.yaml", "agent:\n  targetEnvironment: test\n")
+	writeMigrationFile(t, missingDir, "from-version", "1.0.0")
+
+	results, err := RunMigrationTests(dir, majorVersion(3), *NewLogger(false))
+	req.NoError(err)
+	req.Len(results, 2)
+
+	// The fixture only migrates to v2, so the value is not yet a list
+	assert.Equal(t, "no-expected-values", results[0].Test.Name)
+	assert.False(t, results[0].Passed())
+	assert.Nil(t, results[0].Test.Expected)
+	assert.Equal(t, "rename", results[1].Test.Name)
+	assert.False(t, results[1].Passed())
+
+	for _, result := range results {
+		req.NoError(result.UpdateExpected())
+	}
+
+	results, err = RunMigrationTests(dir, majorVersion(3), *NewLogger(false))
+	req.NoError(err)
+	for _, result := range results {
+		assert.Truef(t, result.Passed(), "test %s should pass after updating the expected values", result.Test.Name)
+	}
+
+	expected, err := os.ReadFile(filepath.Join(missingDir, "expected.yaml"))
+	req.NoError(err)
+	assert.Equal(t, "agent:\n  targetEnvironments:\n  - test\n", string(expected))
+}
+
+func TestHarness_MissingFromVersion(t *testing.T) {
+	dir := t.TempDir()
+	fixtureDir := filepath.Join(dir, MigrationTestsDir, "broken")
+	require.NoError(t, os.MkdirAll(fixtureDir, 0755))
+	writeMigrationFile(t, fixtureDir, "input.yaml", "{}")
+
+	_, err := LoadMigrationTests(dir)
+	require.EqualError(t, err, "error loading migration test broken: missing from-version")
+}
+
+func TestHarness_Params(t *testing.T) {
+	req := require.New(t)
+
+	dir := t.TempDir()
+	writeMigrationFile(t, dir, "to-v2.yaml", "# migration-mode: merge\npersistence:\n  storageClass: {{ .Params.storageClass }}\n")
+	writeMigrationFile(t, dir, "to-v2.meta.yaml", "params:\n  - name: storageClass\n")
+
+	fixtureDir := filepath.Join(dir, MigrationTestsDir, "storage-class")
+	req.NoError(os.MkdirAll(fixtureDir, 0755))
+	writeMigrationFile(t, fixtureDir, "input.yaml", "image: nginx\n")
+	writeMigrationFile(t, fixtureDir, "from-version", "1.0.0\n")
+	writeMigrationFile(t, fixtureDir, "params.yaml", "storageClass: fast-ssd\n")
+	writeMigrationFile(t, fixtureDir, "expected.yaml", "image: nginx\npersistence:\n  storageClass: fast-ssd\n")
+
+	missingDir := filepath.Join(dir, MigrationTestsDir, "missing-params")
+	req.NoError(os.MkdirAll(missingDir, 0755))
+	writeMigrationFile(t, missingDir, "input.yaml", "image: nginx\n")
+	writeMigrationFile(t, missingDir, "from-version", "1.0.0\n")
+
+	results, err := RunMigrationTests(dir, majorVersion(2), *NewLogger(false))
+	req.NoError(err)
+	req.Len(results, 2)
+
+	assert.Equal(t, "missing-params", results[0].Test.Name)
+	assert.ErrorContains(t, results[0].Err, "missing values for migration parameters")
+	assert.Equal(t, "storage-class", results[1].Test.Name)
+	assert.True(t, results[1].Passed())
+}
@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"github.com/Masterminds/semver/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"helm.sh/helm/v3/pkg/action"
@@ -69,14 +70,16 @@ func migrateCharts(t *testing.T, chartV1Path, chartV2Path string) {
 	rel1, err := install.Run(chV1, customValues)
 	req.NoError(err, "Error installing chart v1")
 
-	// Migrate the release user values (config)
-	migratedValues, err := MigrateFromPath(rel1.Config, 1, nil, "test-charts/v2/value-migrations/", *NewLogger(false))
-	req.NoError(err, "Error migrating values")
-
 	// Load the v2 chart
 	chV2, err := loader.Load(chartV2Path)
 	req.NoError(err, "Error loading chart v2")
 
+	// Migrate the release user values (config)
+	vFrom := semver.MustParse(rel1.Chart.Metadata.Version)
+	vTo := semver.MustParse(chV2.Metadata.Version)
+	migratedValues, err := MigrateFromPath(rel1.Config, vFrom, vTo, "test-charts/v2/value-migrations/", *NewLogger(false))
+	req.NoError(err, "Error migrating values")
+
 	upAction := action.NewUpgrade(config)
 	upAction.ResetThenReuseValues = true
 
@@ -0,0 +1,201 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+type LintSeverity string
+
+const (
+	LintError   LintSeverity = "error"
+	LintWarning LintSeverity = "warning"
+)
+
+const (
+	LintRuleInvalidMigration   = "invalid-migration"
+	LintRuleUnexpectedFile     = "unexpected-file"
+	LintRuleDuplicateVersion   = "duplicate-version"
+	LintRuleVersionGap         = "version-gap"
+	LintRuleMissingUpMigration = "missing-up-migration"
+	LintRuleChartVersion       = "chart-version"
+	LintRuleInvalidTest        = "invalid-test"
+)
+
+// LintRules describes each of the rules checked by LintMigrations
+var LintRules = map[string]string{
+	LintRuleInvalidMigration:   "Migration files must parse in their format, e.g. as a Go template with the migration functions, and metadata files must be valid.",
+	LintRuleUnexpectedFile:     "Files in the migrations directory must be named to-v{VERSION}[.{KIND}].{EXT} or from-v{VERSION}[.{KIND}].{EXT}, or be the metadata file of a migration, or the _helpers.tpl partials.",
+	LintRuleDuplicateVersion:   "Only one migration file may exist per version and direction.",
+	LintRuleVersionGap:         "Migrations are expected for consecutive major versions (or minor versions of 0.x charts).",
+	LintRuleMissingUpMigration: "A down migration reverses an up migration of the same version.",
+	LintRuleChartVersion:       "The highest migration version should be for the chart's current major version, and no greater than the chart's version.",
+	LintRuleInvalidTest:        "Migration test fixtures must contain valid input values and versions.",
+}
+
+// LintIssue is a problem found in a migrations directory
+type LintIssue struct {
+	Severity LintSeverity `json:"severity"`
+	Rule     string       `json:"rule"`
+	// File is relative to the migrations directory, and is empty for issues with the directory as a whole
+	File    string `json:"file,omitempty"`
+	Message string `json:"message"`
+}
+
+func (i LintIssue) String() string {
+	if i.File == "" {
+		return fmt.Sprintf("%s: %s [%s]", i.Severity, i.Message, i.Rule)
+	}
+	return fmt.Sprintf("%s: %s: %s [%s]", i.Severity, i.File, i.Message, i.Rule)
+}
+
+// LintMigrations checks every file in the migrations directory, without applying any migrations. The chart's version
+// is optional, and is used to check that the migrations are up-to-date with the chart.
+func LintMigrations(migrationsDir string, chartVersion *semver.Version) ([]LintIssue, error) {
+	entries, err := os.ReadDir(migrationsDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations directory: %w", err)
+	}
+
+	var issues []LintIssue
+	report := func(severity LintSeverity, rule string, file string, format string, args ...interface{}) {
+		issues = append(issues, LintIssue{Severity: severity, Rule: rule, File: file, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var migrations, metadata []FileSystemMigrationMeta
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			if name != MigrationTestsDir {
+				report(LintWarning, LintRuleUnexpectedFile, name, "unexpected directory, only the %s directory is expected", MigrationTestsDir)
+			}
+			continue
+		}
+
+		if name == HelpersFileName {
+			content, err := os.ReadFile(filepath.Join(migrationsDir, name))
+			if err != nil {
+				return nil, fmt.Errorf("error reading %s: %w", HelpersFileName, err)
+			}
+			if _, err = parseMigrationTemplate("", string(content)); err != nil {
+				report(LintError, LintRuleInvalidMigration, name, "%v", err)
+			}
+			continue
+		}
+
+		if ver, direction, ok := parseMetadataFileName(name); ok {
+			idx := slices.IndexFunc(metadata, func(m FileSystemMigrationMeta) bool { return m.Direction == direction && m.Version.Equal(ver) })
+			if idx != -1 {
+				report(LintError, LintRuleDuplicateVersion, name, "found multiple metadata files for the %s migration for version %s, '%s' is also defined", direction, ver, metadata[idx].Path)
+			}
+			metadata = append(metadata, FileSystemMigrationMeta{Version: ver, Direction: direction, Path: name})
+
+			content, err := os.ReadFile(filepath.Join(migrationsDir, name))
+			if err != nil {
+				return nil, fmt.Errorf("error reading migration metadata file: %w", err)
+			}
+			if _, err = parseMigrationMetadata(string(content)); err != nil {
+				report(LintError, LintRuleInvalidMigration, name, "%v", err)
+			}
+			continue
+		}
+
+		ver, direction, format, ok := parseMigrationFileName(name)
+		if !ok {
+			report(LintWarning, LintRuleUnexpectedFile, name, "file name does not match the migration naming pattern, e.g. to-v2.yaml or to-v2.ops.yaml, so it is ignored")
+			continue
+		}
+
+		idx := slices.IndexFunc(migrations, func(m FileSystemMigrationMeta) bool { return m.Direction == direction && m.Version.Equal(ver) })
+		if idx != -1 {
+			report(LintError, LintRuleDuplicateVersion, name, "found multiple %s migrations for version %s, '%s' is also defined", direction, ver, migrations[idx].Path)
+		}
+		migrations = append(migrations, FileSystemMigrationMeta{Version: ver, Direction: direction, Path: name})
+
+		content, err := os.ReadFile(filepath.Join(migrationsDir, name))
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration file: %w", err)
+		}
+		if err = parseMigration(format, string(content)); err != nil {
+			report(LintError, LintRuleInvalidMigration, name, "%v", err)
+		}
+	}
+
+	for _, m := range metadata {
+		if !slices.ContainsFunc(migrations, func(migration FileSystemMigrationMeta) bool {
+			return migration.Direction == m.Direction && migration.Version.Equal(m.Version)
+		}) {
+			report(LintWarning, LintRuleUnexpectedFile, m.Path, "metadata file has no matching %s migration for version %s, so it is ignored", m.Direction, m.Version)
+		}
+	}
+
+	versionsOf := func(d Direction) []*semver.Version {
+		var versions []*semver.Version
+		for _, m := range migrations {
+			if m.Direction == d && !slices.ContainsFunc(versions, m.Version.Equal) {
+				versions = append(versions, m.Version)
+			}
+		}
+		slices.SortFunc(versions, (*semver.Version).Compare)
+		return versions
+	}
+	up, down := versionsOf(Up), versionsOf(Down)
+
+	for i := 1; i < len(up); i++ {
+		if isVersionGap(up[i-1], up[i]) {
+			report(LintWarning, LintRuleVersionGap, "", "no migrations between versions %s and %s, ignore this if the values did not change in the versions between", up[i-1], up[i])
+		}
+	}
+
+	for _, v := range down {
+		if !slices.ContainsFunc(up, v.Equal) {
+			report(LintWarning, LintRuleMissingUpMigration, "", "down migration for version %s has no matching up migration", v)
+		}
+	}
+
+	if chartVersion != nil && len(up) > 0 {
+		highest := up[len(up)-1]
+		if highest.GreaterThan(chartVersion) {
+			report(LintError, LintRuleChartVersion, "", "the migration for version %s is newer than the chart's version %s, so it will not be applied when upgrading to this chart", highest, chartVersion)
+		} else if highest.Major() != chartVersion.Major() {
+			report(LintWarning, LintRuleChartVersion, "", "the highest migration version %s is not for the chart's current major version %d", highest, chartVersion.Major())
+		}
+	}
+
+	if _, err = LoadMigrationTests(migrationsDir); err != nil {
+		report(LintError, LintRuleInvalidTest, MigrationTestsDir, "%v", err)
+	}
+
+	return issues, nil
+}
+
+// parseMigration parses the content of a migration in the same way as when it is applied
+func parseMigration(format MigrationFormat, content string) error {
+	var err error
+	switch format {
+	case TemplateFormat:
+		if _, err = migrationModeOf(content); err == nil {
+			_, err = parseMigrationTemplate(content, "")
+		}
+	case OperationsFormat:
+		_, err = parseOperations(content)
+	case JSONPatchFormat:
+		_, err = parseJSONPatch(content)
+	case MergePatchFormat:
+		_, err = parseMergePatch(content)
+	default:
+		err = fmt.Errorf("unsupported migration format '%s'", format)
+	}
+	return err
+}
+
+// isVersionGap reports whether a major version, or a minor version of a 0.x chart, is skipped between the versions
+func isVersionGap(from *semver.Version, to *semver.Version) bool {
+	if from.Major() == 0 && to.Major() == 0 {
+		return to.Minor() > from.Minor()+1
+	}
+	return to.Major() > from.Major()+1
+}
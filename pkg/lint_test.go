@@ -0,0 +1,109 @@
+package pkg
+
+import (
+	"github.com/Masterminds/semver/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLint_ValidMigrations(t *testing.T) {
+	issues, err := LintMigrations("test-charts/v2/value-migrations", majorVersion(2))
+	require.NoError(t, err)
+	assert.Empty(t, issues)
+}
+
+func TestLint_Issues(t *testing.T) {
+	dir := t.TempDir()
+	writeMigrationFile(t, dir, "to-v1.yaml", "agent: {{ .agent | toYaml | indent 2 }}\n")
+	writeMigrationFile(t, dir, "to-v2.yaml", "agent: {{ .agent | notAFunction }}\n")
+	writeMigrationFile(t, dir, "to-v2.ops.yaml", "- op: delete\n  path: agent.name\n")
+	writeMigrationFile(t, dir, "to-v4.patch.json", `[{"op": "rename", "path": "/agent"}]`)
+	writeMigrationFile(t, dir, "to-v5.merge.yaml", "- not a map\n")
+	writeMigrationFile(t, dir, "from-v3.ops.yaml", "- op: delete\n  path: agent.name\n")
+	writeMigrationFile(t, dir, "to-v6.yml.bak", "")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "old"), 0755))
+
+	issues, err := LintMigrations(dir, semver.MustParse("6.1.0"))
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []LintIssue{
+		{Severity: LintWarning, Rule: LintRuleUnexpectedFile, File: "old", Message: "unexpected directory, only the tests directory is expected"},
+		{Severity: LintWarning, Rule: LintRuleUnexpectedFile, File: "to-v6.yml.bak", Message: "file name does not match the migration naming pattern, e.g. to-v2.yaml or to-v2.ops.yaml, so it is ignored"},
+		{Severity: LintError, Rule: LintRuleInvalidMigration, File: "to-v2.yaml", Message: `error parsing migration template: template: migration:1: function "notAFunction" not defined`},
+		{Severity: LintError, Rule: LintRuleDuplicateVersion, File: "to-v2.yaml", Message: "found multiple up migrations for version 2.0.0, 'to-v2.ops.yaml' is also defined"},
+		{Severity: LintError, Rule: LintRuleInvalidMigration, File: "to-v4.patch.json", Message: "operation 1 (rename): unknown operation 'rename'"},
+		{Severity: LintError, Rule: LintRuleInvalidMigration, File: "to-v5.merge.yaml", Message: "JSON merge patch must be a map, got a list"},
+		{Severity: LintWarning, Rule: LintRuleVersionGap, Message: "no migrations between versions 2.0.0 and 4.0.0, ignore this if the values did not change in the versions between"},
+		{Severity: LintWarning, Rule: LintRuleMissingUpMigration, Message: "down migration for version 3.0.0 has no matching up migration"},
+		{Severity: LintWarning, Rule: LintRuleChartVersion, Message: "the highest migration version 5.0.0 is not for the chart's current major version 6"},
+	}, issues)
+}
+
+func TestLint_ChartVersion(t *testing.T) {
+	dir := t.TempDir()
+	writeMigrationFile(t, dir, "to-v0.7.yaml", "{}")
+	writeMigrationFile(t, dir, "to-v0.9.yaml", "{}")
+
+	issues, err := LintMigrations(dir, semver.MustParse("0.8.2"))
+	require.NoError(t, err)
+
+	assert.Equal(t, []LintIssue{
+		{Severity: LintWarning, Rule: LintRuleVersionGap, Message: "no migrations between versions 0.7.0 and 0.9.0, ignore this if the values did not change in the versions between"},
+		{Severity: LintError, Rule: LintRuleChartVersion, Message: "the migration for version 0.9.0 is newer than the chart's version 0.8.2, so it will not be applied when upgrading to this chart"},
+	}, issues)
+}
+
+func TestLint_InvalidTestFixture(t *testing.T) {
+	dir := t.TempDir()
+	writeMigrationFile(t, dir, "to-v2.yaml", "{}")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, MigrationTestsDir, "broken"), 0755))
+	writeMigrationFile(t, filepath.Join(dir, MigrationTestsDir, "broken"), "input.yaml", "{}")
+
+	issues, err := LintMigrations(dir, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []LintIssue{
+		{Severity: LintError, Rule: LintRuleInvalidTest, File: MigrationTestsDir, Message: "error loading migration test broken: missing from-version"},
+	}, issues)
+}
+
+func TestLint_Metadata(t *testing.T) {
+	dir := t.TempDir()
+	writeMigrationFile(t, dir, "to-v2.ops.yaml", "- op: delete\n  path: agent.name\n")
+	writeMigrationFile(t, dir, "to-v2.meta.yaml", "title: Remove the agent name\n")
+	writeMigrationFile(t, dir, "to-v2.meta.yml", "title: Remove the agent name\n")
+	writeMigrationFile(t, dir, "to-v3.ops.yaml", "- op: delete\n  path: agent.id\n")
+	writeMigrationFile(t, dir, "to-v3.meta.yaml", "apiVersion: helm-migrate-values/v9\n")
+	writeMigrationFile(t, dir, "to-v4.meta.yaml", "title: No migration\n")
+
+	issues, err := LintMigrations(dir, majorVersion(3))
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []LintIssue{
+		{Severity: LintError, Rule: LintRuleDuplicateVersion, File: "to-v2.meta.yml", Message: "found multiple metadata files for the up migration for version 2.0.0, 'to-v2.meta.yaml' is also defined"},
+		{Severity: LintError, Rule: LintRuleInvalidMigration, File: "to-v3.meta.yaml", Message: "unsupported migration metadata apiVersion 'helm-migrate-values/v9', expected 'helm-migrate-values/v1'"},
+		{Severity: LintWarning, Rule: LintRuleUnexpectedFile, File: "to-v4.meta.yaml", Message: "metadata file has no matching up migration for version 4.0.0, so it is ignored"},
+	}, issues)
+}
+
+func TestLint_Helpers(t *testing.T) {
+	dir := t.TempDir()
+	writeMigrationFile(t, dir, "to-v2.yaml", "agent: {{ include \"agent\" . }}\n")
+	writeMigrationFile(t, dir, HelpersFileName, "{{ define \"agent\" }}{{ .agent | quote }}{{ end }}\n")
+
+	issues, err := LintMigrations(dir, majorVersion(2))
+	require.NoError(t, err)
+	assert.Empty(t, issues)
+
+	writeMigrationFile(t, dir, HelpersFileName, "{{ define \"agent\" }}{{ .agent | quote }}\n")
+
+	issues, err = LintMigrations(dir, majorVersion(2))
+	require.NoError(t, err)
+	require.Len(t, issues, 1)
+	assert.Equal(t, LintRuleInvalidMigration, issues[0].Rule)
+	assert.Equal(t, HelpersFileName, issues[0].File)
+	assert.Contains(t, issues[0].Message, "error parsing _helpers.tpl")
+}
@@ -0,0 +1,77 @@
+package pkg
+
+import "fmt"
+
+// mergeValues deep-merges the overrides on top of a copy of the base values. Maps are merged key by key, any other
+// value in the overrides replaces the base value, and a null override removes the key altogether.
+func mergeValues(base, overrides map[string]interface{}) map[string]interface{} {
+	merged := normalizeMap(base)
+	if merged == nil {
+		merged = make(map[string]interface{})
+	}
+
+	for key, override := range normalizeMap(overrides) {
+		if override == nil {
+			delete(merged, key)
+			continue
+		}
+
+		overrideMap, overrideIsMap := override.(map[string]interface{})
+		baseMap, baseIsMap := merged[key].(map[string]interface{})
+		if overrideIsMap && baseIsMap {
+			merged[key] = mergeValues(baseMap, overrideMap)
+			continue
+		}
+
+		if overrideIsMap {
+			// Removal markers have nothing to remove from, so drop them before storing the new map.
+			merged[key] = mergeValues(nil, overrideMap)
+			continue
+		}
+
+		merged[key] = override
+	}
+
+	return merged
+}
+
+// normalizeMap returns a deep copy of the values in which every nested map is a map[string]interface{}, as produced by
+// JSON decoding. yaml.v2 decodes nested maps as map[interface{}]interface{}, which neither Helm nor encoding/json handle.
+func normalizeMap(values map[string]interface{}) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+
+	normalized := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		normalized[key] = normalizeValue(value)
+	}
+	return normalized
+}
+
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return normalizeMap(v)
+	case map[interface{}]interface{}:
+		normalized := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			normalized[fmt.Sprint(key)] = normalizeValue(item)
+		}
+		return normalized
+	case []interface{}:
+		normalized := make([]interface{}, len(v))
+		for i, item := range v {
+			normalized[i] = normalizeValue(item)
+		}
+		return normalized
+	default:
+		return v
+	}
+}
+
+// NormalizeValues returns a deep copy of the values that can be passed to Helm or encoded as JSON, converting the
+// map[interface{}]interface{} maps produced by YAML decoding into map[string]interface{}.
+func NormalizeValues(values map[string]interface{}) map[string]interface{} {
+	return normalizeMap(values)
+}
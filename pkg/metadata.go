@@ -0,0 +1,153 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"gopkg.in/yaml.v2"
+	"runtime/debug"
+	"slices"
+	"strings"
+)
+
+// MigrationMetadataAPIVersion is the version of the metadata format supported by this version of the plugin
+const MigrationMetadataAPIVersion = "helm-migrate-values/v1"
+
+// metadataSuffixes are the suffixes of the metadata files that can sit next to a migration, e.g. to-v2.meta.yaml
+var metadataSuffixes = []string{".meta.yaml", ".meta.yml"}
+
+// PluginVersion is the version of the plugin, which is set with -ldflags by the release and `make build`. Builds that
+// do not set it fall back to the module version recorded by `go install`.
+var PluginVersion = ""
+
+// MigrationMetadata describes a migration, from the optional metadata file next to it, e.g. to-v2.meta.yaml for the
+// to-v2 migration in any format
+type MigrationMetadata struct {
+	APIVersion  string `yaml:"apiVersion"`
+	Title       string `yaml:"title"`
+	Description string `yaml:"description"`
+	// Breaking lists changes that users must act on, e.g. values that could not be migrated automatically
+	Breaking []string        `yaml:"breaking"`
+	Links    []MigrationLink `yaml:"links"`
+	// MinPluginVersion is the earliest version of the plugin that can apply the migration
+	MinPluginVersion string `yaml:"minPluginVersion"`
+	// Params are the parameters of a template migration, which are supplied when the migration is applied
+	Params []MigrationParam `yaml:"params"`
+	// TemplateContext opts a template migration in to the full template context, with the values as .Values
+	TemplateContext TemplateContextMode `yaml:"templateContext"`
+}
+
+type MigrationLink struct {
+	Title string `yaml:"title"`
+	URL   string `yaml:"url"`
+}
+
+// parseMetadataFileName returns the version and direction of the migration a metadata file describes, or false if the
+// name is not one of a metadata file
+func parseMetadataFileName(fileName string) (*semver.Version, Direction, bool) {
+	for _, suffix := range metadataSuffixes {
+		if base, ok := strings.CutSuffix(fileName, suffix); ok {
+			// The metadata file is named as a template migration would be
+			ver, direction, format, ok := parseMigrationFileName(base + ".yaml")
+			return ver, direction, ok && format == TemplateFormat
+		}
+	}
+	return nil, Up, false
+}
+
+// parseMigrationMetadata parses and validates the content of a metadata file
+func parseMigrationMetadata(content string) (*MigrationMetadata, error) {
+	var metadata MigrationMetadata
+	if err := yaml.UnmarshalStrict([]byte(content), &metadata); err != nil {
+		return nil, fmt.Errorf("error parsing migration metadata: %w", err)
+	}
+
+	if metadata.APIVersion != "" && metadata.APIVersion != MigrationMetadataAPIVersion {
+		return nil, fmt.Errorf("unsupported migration metadata apiVersion '%s', expected '%s'", metadata.APIVersion, MigrationMetadataAPIVersion)
+	}
+	if metadata.MinPluginVersion != "" {
+		if _, err := semver.NewVersion(metadata.MinPluginVersion); err != nil {
+			return nil, fmt.Errorf("error parsing minPluginVersion %s: %w", metadata.MinPluginVersion, err)
+		}
+	}
+	for _, link := range metadata.Links {
+		if link.URL == "" {
+			return nil, fmt.Errorf("link '%s' has no url", link.Title)
+		}
+	}
+	if err := validateTemplateContextMode(metadata.TemplateContext); err != nil {
+		return nil, err
+	}
+	for i, param := range metadata.Params {
+		if err := param.validate(); err != nil {
+			return nil, err
+		}
+		if slices.ContainsFunc(metadata.Params[:i], func(p MigrationParam) bool { return p.Name == param.Name }) {
+			return nil, fmt.Errorf("parameter %s is declared more than once", param.Name)
+		}
+	}
+
+	return &metadata, nil
+}
+
+// checkPluginVersion returns an error if the migration requires a later version of the plugin
+func (m *MigrationMetadata) checkPluginVersion() error {
+	if m == nil || m.MinPluginVersion == "" {
+		return nil
+	}
+
+	current, err := pluginVersion()
+	if err != nil {
+		return fmt.Errorf("the migration requires version %s or later of the plugin: %w", m.MinPluginVersion, err)
+	}
+
+	// The version was validated when the metadata was parsed
+	required := semver.MustParse(m.MinPluginVersion)
+	if current.LessThan(required) {
+		return fmt.Errorf("the migration requires version %s or later of the plugin, but this is version %s. Update the plugin with helm plugin update migrate-values", required, current)
+	}
+	return nil
+}
+
+// pluginVersion returns the version of the plugin. A build without a version cannot tell whether it supports a
+// migration, so it is an error rather than skipping the check.
+func pluginVersion() (*semver.Version, error) {
+	version := PluginVersion
+	if version == "" {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			version = info.Main.Version
+		}
+	}
+	if version == "" || version == "(devel)" {
+		return nil, fmt.Errorf("the version of this build of the plugin is unknown. Build it with make build, or set the version with -ldflags \"-X github.com/octopusdeploylabs/helm-migrate-values/pkg.PluginVersion=VERSION\"")
+	}
+
+	current, err := semver.NewVersion(version)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the plugin version %s: %w", version, err)
+	}
+	return current, nil
+}
+
+// Notes formats the metadata as notes for the users whose values the migration changed, or returns an empty string if
+// there is nothing to note
+func (m *MigrationMetadata) Notes() string {
+	if m == nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	if m.Description != "" {
+		sb.WriteString(strings.TrimSpace(m.Description) + "\n")
+	}
+	for _, breaking := range m.Breaking {
+		sb.WriteString("BREAKING: " + strings.TrimSpace(breaking) + "\n")
+	}
+	for _, link := range m.Links {
+		if link.Title == "" {
+			sb.WriteString("See " + link.URL + "\n")
+		} else {
+			sb.WriteString(fmt.Sprintf("See %s: %s\n", link.Title, link.URL))
+		}
+	}
+	return sb.String()
+}
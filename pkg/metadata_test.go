@@ -0,0 +1,129 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	"testing"
+)
+
+func TestParseMetadataFileName(t *testing.T) {
+	tests := []struct {
+		fileName  string
+		version   string
+		direction Direction
+		ok        bool
+	}{
+		{fileName: "to-v2.meta.yaml", version: "2.0.0", direction: Up, ok: true},
+		{fileName: "from-v1.5.meta.yml", version: "1.5.0", direction: Down, ok: true},
+		{fileName: "to-v2.yaml", ok: false},
+		{fileName: "to-v2.ops.meta.yaml", ok: false},
+		{fileName: "to-vnext.meta.yaml", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fileName, func(t *testing.T) {
+			version, direction, ok := parseMetadataFileName(tt.fileName)
+			require.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.version, version.String())
+				assert.Equal(t, tt.direction, direction)
+			}
+		})
+	}
+}
+
+func TestParseMigrationMetadata(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expectedErr string
+	}{
+		{name: "valid", content: "apiVersion: helm-migrate-values/v1\ntitle: Rename agent\nminPluginVersion: 1.2.0\n"},
+		{name: "no apiVersion", content: "title: Rename agent\n"},
+		{name: "unsupported apiVersion", content: "apiVersion: helm-migrate-values/v2\n", expectedErr: "unsupported migration metadata apiVersion 'helm-migrate-values/v2'"},
+		{name: "unknown field", content: "summary: Rename agent\n", expectedErr: "field summary not found"},
+		{name: "invalid minPluginVersion", content: "minPluginVersion: latest\n", expectedErr: "error parsing minPluginVersion latest"},
+		{name: "link without url", content: "links:\n  - title: Docs\n", expectedErr: "link 'Docs' has no url"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseMigrationMetadata(tt.content)
+			if tt.expectedErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestMigrationMetadata_FileSystemProvider(t *testing.T) {
+	mp, err := NewFileSystemMigrationProvider("test-charts/v2/value-migrations")
+	require.NoError(t, err)
+
+	m, err := mp.GetMigrationFor(majorVersion(2), Up)
+	require.NoError(t, err)
+	require.NotNil(t, m.Metadata)
+	assert.Equal(t, "Move the target environments", m.Metadata.Title)
+	assert.Equal(t, `The environments a project deploys to are now configured under project.deploymentTarget.initial.environments.
+BREAKING: myKey is no longer used, and is removed.
+See Upgrade guide: https://example.com/my-chart/upgrading-to-v2
+`, m.Metadata.Notes())
+}
+
+func TestMigrationMetadata_ChartFilesProvider(t *testing.T) {
+	files := []*chart.File{
+		{Name: "value-migrations/to-v2.ops.yaml", Data: []byte("- op: delete\n  path: agent.name\n")},
+		{Name: "value-migrations/to-v2.meta.yaml", Data: []byte("description: The agent name is no longer used.\n")},
+		{Name: "value-migrations/from-v2.ops.yaml", Data: []byte("[]\n")},
+		{Name: "value-migrations/to-v3.meta.yaml", Data: []byte("description: No migration.\n")},
+	}
+
+	mp, err := NewChartFilesMigrationProvider(files, "value-migrations")
+	require.NoError(t, err)
+
+	up, err := mp.GetMigrationFor(majorVersion(2), Up)
+	require.NoError(t, err)
+	require.NotNil(t, up.Metadata)
+	assert.Equal(t, "The agent name is no longer used.\n", up.Metadata.Notes())
+
+	down, err := mp.GetMigrationFor(majorVersion(2), Down)
+	require.NoError(t, err)
+	assert.Nil(t, down.Metadata)
+}
+
+func TestMigrationMetadata_MinPluginVersion(t *testing.T) {
+	defer func(version string) { PluginVersion = version }(PluginVersion)
+
+	mp := &MemoryMigrationProvider{}
+	mp.AddMigration(majorVersion(2), OperationsFormat, "- op: delete\n  path: agent.name\n")
+	mp.Migrations[0].Metadata = &MigrationMetadata{MinPluginVersion: "1.5.0"}
+	values := map[string]interface{}{"agent": map[string]interface{}{"name": "my-agent"}}
+
+	for _, version := range []string{"1.5.0", "2.0.0", "v1.5.1"} {
+		PluginVersion = version
+		_, err := NewMigrator(mp, *NewLogger(false)).Migrate(values, majorVersion(1), majorVersion(2))
+		require.NoError(t, err, "plugin version '%s'", version)
+	}
+
+	PluginVersion = "1.4.2"
+	_, err := NewMigrator(mp, *NewLogger(false)).Migrate(values, majorVersion(1), majorVersion(2))
+	require.ErrorContains(t, err, "cannot apply migration to-v2.0.0: the migration requires version 1.5.0 or later of the plugin, but this is version 1.4.2")
+
+	// Test binaries have no module version, so a build without a version refuses the migration rather than skipping
+	// the check
+	PluginVersion = ""
+	_, err = NewMigrator(mp, *NewLogger(false)).Migrate(values, majorVersion(1), majorVersion(2))
+	require.ErrorContains(t, err, "the migration requires version 1.5.0 or later of the plugin: the version of this build of the plugin is unknown")
+
+	PluginVersion = "dev"
+	_, err = NewMigrator(mp, *NewLogger(false)).Migrate(values, majorVersion(1), majorVersion(2))
+	require.ErrorContains(t, err, "error parsing the plugin version dev")
+
+	// Migrations without a minimum version do not need the plugin version
+	mp.Migrations[0].Metadata = &MigrationMetadata{Title: "Remove the agent name"}
+	_, err = NewMigrator(mp, *NewLogger(false)).Migrate(values, majorVersion(1), majorVersion(2))
+	require.NoError(t, err)
+}
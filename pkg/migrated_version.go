@@ -0,0 +1,47 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"maps"
+)
+
+// MigratedVersionKey is the reserved top-level key of the values that records the values schema version they were
+// migrated to. It is written with the migrated values, so it is kept however they are applied to the release.
+const MigratedVersionKey = "helm-migrate-values/migrated-version"
+
+// MigratedVersion returns the values schema version recorded in the values, or nil if they do not record one
+func MigratedVersion(values map[string]interface{}) (*semver.Version, error) {
+	recorded, ok := values[MigratedVersionKey]
+	if !ok || recorded == nil {
+		return nil, nil
+	}
+
+	version, err := semver.NewVersion(fmt.Sprint(recorded))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s value %v: %w", MigratedVersionKey, recorded, err)
+	}
+	return version, nil
+}
+
+// RecordMigratedVersion returns a copy of the values that records the schema version they were migrated to
+func RecordMigratedVersion(values map[string]interface{}, version *semver.Version) map[string]interface{} {
+	recorded := maps.Clone(values)
+	if recorded == nil {
+		recorded = map[string]interface{}{}
+	}
+	recorded[MigratedVersionKey] = version.String()
+	return recorded
+}
+
+// WithoutMigratedVersion returns the values without the recorded schema version. The values are only copied if they
+// record one.
+func WithoutMigratedVersion(values map[string]interface{}) map[string]interface{} {
+	if _, ok := values[MigratedVersionKey]; !ok {
+		return values
+	}
+
+	without := maps.Clone(values)
+	delete(without, MigratedVersionKey)
+	return without
+}
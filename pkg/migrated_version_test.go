@@ -0,0 +1,66 @@
+package pkg
+
+import (
+	"github.com/Masterminds/semver/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestMigratedVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		values      map[string]interface{}
+		expected    string
+		expectedErr string
+	}{
+		{
+			name:   "not recorded",
+			values: map[string]interface{}{"agent": map[string]interface{}{"name": "my-agent"}},
+		},
+		{
+			name:     "recorded",
+			values:   map[string]interface{}{MigratedVersionKey: "2.1.0"},
+			expected: "2.1.0",
+		},
+		{
+			name:     "recorded as a number",
+			values:   map[string]interface{}{MigratedVersionKey: 2},
+			expected: "2.0.0",
+		},
+		{
+			name:        "invalid",
+			values:      map[string]interface{}{MigratedVersionKey: "latest"},
+			expectedErr: "failed to parse helm-migrate-values/migrated-version value latest",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, err := MigratedVersion(tt.values)
+			if tt.expectedErr != "" {
+				require.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			if tt.expected == "" {
+				assert.Nil(t, version)
+			} else {
+				assert.Equal(t, tt.expected, version.String())
+			}
+		})
+	}
+}
+
+func TestRecordMigratedVersion(t *testing.T) {
+	values := map[string]interface{}{"agent": map[string]interface{}{"name": "my-agent"}, MigratedVersionKey: "1.0.0"}
+
+	recorded := RecordMigratedVersion(values, semver.MustParse("2.0.0"))
+
+	assert.Equal(t, map[string]interface{}{"agent": map[string]interface{}{"name": "my-agent"}, MigratedVersionKey: "2.0.0"}, recorded)
+	assert.Equal(t, "1.0.0", values[MigratedVersionKey], "the values are not changed")
+
+	without := WithoutMigratedVersion(recorded)
+	assert.Equal(t, map[string]interface{}{"agent": map[string]interface{}{"name": "my-agent"}}, without)
+	assert.Equal(t, "2.0.0", recorded[MigratedVersionKey], "the values are not changed")
+}
@@ -2,18 +2,26 @@ package pkg
 
 import (
 	"fmt"
+	"github.com/Masterminds/semver/v3"
 	"gopkg.in/yaml.v2"
+	"helm.sh/helm/v3/pkg/chart"
 	"iter"
-	"maps"
 	"os"
+	"path"
 	"path/filepath"
-	"regexp"
-	"strconv"
+	"slices"
+	"strings"
 )
 
+// HelpersFileName is the file, in the migrations directory, of the partials shared by every template migration in the
+// directory. Like a chart's _helpers.tpl, it defines templates that migrations use with include or template.
+const HelpersFileName = "_helpers.tpl"
+
 type FileSystemMigrationProvider struct {
-	BaseDir        string
-	VersionPathMap map[int]string
+	BaseDir    string
+	Migrations []FileSystemMigrationMeta
+	// Helpers is the content of the directory's _helpers.tpl, if it has one
+	Helpers string
 }
 
 func NewFileSystemMigrationProvider(dir string) (*FileSystemMigrationProvider, error) {
@@ -22,97 +30,335 @@ func NewFileSystemMigrationProvider(dir string) (*FileSystemMigrationProvider, e
 		return nil, err
 	}
 
+	helpers, err := os.ReadFile(filepath.Join(dir, HelpersFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading %s: %w", HelpersFileName, err)
+	}
+
 	return &FileSystemMigrationProvider{
-		BaseDir:        dir,
-		VersionPathMap: md,
+		BaseDir:    dir,
+		Migrations: md,
+		Helpers:    string(helpers),
 	}, nil
 }
 
 type FileSystemMigrationMeta struct {
-	ToVersion int
+	Version   *semver.Version
+	Direction Direction
 	Path      string
+	// MetadataPath is the migration's metadata file, if it has one
+	MetadataPath string
+}
+
+// Direction distinguishes migrations that upgrade values to a newer schema (to-vN) from those that downgrade values
+// from a schema back to the previous one (from-vN).
+type Direction int
+
+const (
+	Up Direction = iota
+	Down
+)
+
+func (d Direction) String() string {
+	if d == Down {
+		return "down"
+	}
+	return "up"
 }
 
+// MigrationFormat identifies how the content of a migration is interpreted.
+type MigrationFormat string
+
+const (
+	// TemplateFormat migrations are Go templates rendering the migrated values (to-vN.yaml).
+	TemplateFormat MigrationFormat = "template"
+	// OperationsFormat migrations are a list of declarative operations (to-vN.ops.yaml).
+	OperationsFormat MigrationFormat = "operations"
+	// JSONPatchFormat migrations are RFC 6902 JSON Patch documents (to-vN.patch.json or to-vN.patch.yaml).
+	JSONPatchFormat MigrationFormat = "json-patch"
+	// MergePatchFormat migrations are RFC 7396 JSON Merge Patch documents (to-vN.merge.yaml or to-vN.merge.json).
+	MergePatchFormat MigrationFormat = "merge-patch"
+)
+
 type Migration struct {
-	ToVersion int
-	Data      map[string]interface{}
+	// Version is the schema version the migration upgrades to, or for a down migration, downgrades from.
+	Version   *semver.Version
+	Direction Direction
+	Name      string
+	Format    MigrationFormat
+	Content   string
+	// Metadata is nil if the migration has no metadata file
+	Metadata *MigrationMetadata
+	// Helpers are the partials shared by the template migrations in the migration's directory
+	Helpers string
+}
+
+// parseMigrationFileName returns the version, direction and format of a migration file, or false if the name is not
+// one of a migration file. Migration files are named to-v{VERSION}[.{KIND}].{EXT} for upgrades and
+// from-v{VERSION}[.{KIND}].{EXT} for downgrades, where VERSION is a full or partial semantic version such as 2, 0.7 or
+// 2.3.0-beta.1.
+func parseMigrationFileName(fileName string) (*semver.Version, Direction, MigrationFormat, bool) {
+	var direction Direction
+	var base string
+	switch {
+	case strings.HasPrefix(fileName, "to-v"):
+		direction, base = Up, strings.TrimPrefix(fileName, "to-v")
+	case strings.HasPrefix(fileName, "from-v"):
+		direction, base = Down, strings.TrimPrefix(fileName, "from-v")
+	default:
+		return nil, Up, "", false
+	}
+
+	ext := filepath.Ext(base)
+	base = strings.TrimSuffix(base, ext)
+
+	var format MigrationFormat
+	switch {
+	case strings.HasSuffix(base, ".patch"):
+		format = JSONPatchFormat
+	case strings.HasSuffix(base, ".merge"):
+		format = MergePatchFormat
+	case strings.HasSuffix(base, ".ops"):
+		format = OperationsFormat
+	default:
+		format = TemplateFormat
+	}
+	if format != TemplateFormat {
+		base = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+
+	switch ext {
+	case ".yaml", ".yml":
+	case ".json":
+		// Templates and operations are always YAML
+		if format == TemplateFormat || format == OperationsFormat {
+			return nil, Up, "", false
+		}
+	default:
+		return nil, Up, "", false
+	}
+
+	// Only plain numeric versions are accepted, so that e.g. "to-vnext.yaml" is not mistaken for a migration
+	if base == "" || base[0] < '0' || base[0] > '9' {
+		return nil, Up, "", false
+	}
+
+	version, err := semver.NewVersion(base)
+	if err != nil {
+		return nil, Up, "", false
+	}
+
+	return version, direction, format, true
 }
 
-func loadMigrationMetadata(dir string) (map[int]string, error) {
+func loadMigrationMetadata(dir string) ([]FileSystemMigrationMeta, error) {
 	migrationFiles, err := os.ReadDir(dir)
 	if err != nil {
 		return nil, fmt.Errorf("error reading migrations directory: %w", err)
 	}
 
-	versionPathMap := make(map[int]string)
-
-	filePattern := `^to-v(\d+)\.(yml|yaml)$`
-	re := regexp.MustCompile(filePattern)
+	var migrations []FileSystemMigrationMeta
 
 	for _, file := range migrationFiles {
-		matches := re.FindStringSubmatch(file.Name())
-		if file.IsDir() || len(matches) < 2 {
+		ver, direction, _, ok := parseMigrationFileName(file.Name())
+		if file.IsDir() || !ok {
 			continue
 		}
 
-		ver, err := strconv.Atoi(matches[1])
-		if err != nil {
-			return nil, fmt.Errorf("error parsing version from '%s': %w", file.Name(), err)
+		idx := slices.IndexFunc(migrations, func(m FileSystemMigrationMeta) bool { return m.Direction == direction && m.Version.Equal(ver) })
+		if idx != -1 {
+			return nil, fmt.Errorf("found multiple %s migrations for version %s: '%s' and '%s'", direction, ver, migrations[idx].Path, file.Name())
 		}
 
-		versionPathMap[ver] = file.Name()
+		migrations = append(migrations, FileSystemMigrationMeta{Version: ver, Direction: direction, Path: file.Name()})
 	}
 
-	return versionPathMap, nil
+	// Metadata files without a migration are ignored
+	for _, file := range migrationFiles {
+		ver, direction, ok := parseMetadataFileName(file.Name())
+		if file.IsDir() || !ok {
+			continue
+		}
+
+		idx := slices.IndexFunc(migrations, func(m FileSystemMigrationMeta) bool { return m.Direction == direction && m.Version.Equal(ver) })
+		if idx == -1 {
+			continue
+		}
+		if migrations[idx].MetadataPath != "" {
+			return nil, fmt.Errorf("found multiple metadata files for the %s migration for version %s: '%s' and '%s'", direction, ver, migrations[idx].MetadataPath, file.Name())
+		}
+		migrations[idx].MetadataPath = file.Name()
+	}
+
+	return migrations, nil
 }
 
 type MigrationProvider interface {
-	GetTemplateFor(v int) (string, error)
-	GetVersions() iter.Seq[int]
+	GetMigrationFor(v *semver.Version, d Direction) (*Migration, error)
+	GetVersions(d Direction) iter.Seq[*semver.Version]
 }
 
-func (f *FileSystemMigrationProvider) GetTemplateFor(v int) (string, error) {
-	fPath := f.VersionPathMap[v]
-	if fPath == "" {
-		return "", fmt.Errorf("no migration found for version %d", v)
+func (f *FileSystemMigrationProvider) GetMigrationFor(v *semver.Version, d Direction) (*Migration, error) {
+	idx := slices.IndexFunc(f.Migrations, func(m FileSystemMigrationMeta) bool { return m.Direction == d && m.Version.Equal(v) })
+	if idx == -1 {
+		return nil, fmt.Errorf("no %s migration found for version %s", d, v)
 	}
 
+	fPath := f.Migrations[idx].Path
 	fullPath := filepath.Join(f.BaseDir, fPath)
-	mTemplate, err := os.ReadFile(fullPath)
+	content, err := os.ReadFile(fullPath)
 	if err != nil {
-		return "", fmt.Errorf("error reading migration template: %w", err)
+		return nil, fmt.Errorf("error reading migration file: %w", err)
+	}
+
+	_, _, format, _ := parseMigrationFileName(fPath)
+
+	var metadata *MigrationMetadata
+	if metadataPath := f.Migrations[idx].MetadataPath; metadataPath != "" {
+		data, err := os.ReadFile(filepath.Join(f.BaseDir, metadataPath))
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration metadata file: %w", err)
+		}
+		if metadata, err = parseMigrationMetadata(string(data)); err != nil {
+			return nil, fmt.Errorf("%s: %w", metadataPath, err)
+		}
 	}
 
-	return string(mTemplate), nil
+	return &Migration{
+		Version:   v,
+		Direction: d,
+		Name:      fPath,
+		Format:    format,
+		Content:   string(content),
+		Metadata:  metadata,
+		Helpers:   f.Helpers,
+	}, nil
 }
 
-func (f *FileSystemMigrationProvider) GetVersions() iter.Seq[int] {
-	return maps.Keys(f.VersionPathMap)
+func (f *FileSystemMigrationProvider) GetVersions(d Direction) iter.Seq[*semver.Version] {
+	return func(yield func(*semver.Version) bool) {
+		for _, m := range f.Migrations {
+			if m.Direction == d && !yield(m.Version) {
+				return
+			}
+		}
+	}
 }
 
 type MemoryMigrationProvider struct {
-	VersionDataMap map[int]string
+	Migrations []Migration
+	// Helpers are the partials shared by the template migrations
+	Helpers string
 }
 
-func (m *MemoryMigrationProvider) GetTemplateFor(v int) (string, error) {
-	data, ok := m.VersionDataMap[v]
-	if !ok {
-		return "", fmt.Errorf("no migration found for version %d", v)
+// NewChartFilesMigrationProvider loads the migrations in the given directory of a loaded chart's files. This allows
+// migrations to be read from a chart stored with a release, or from a packaged subchart, without extracting it.
+func NewChartFilesMigrationProvider(files []*chart.File, dir string) (*MemoryMigrationProvider, error) {
+	mp := &MemoryMigrationProvider{}
+	dir = path.Clean(filepath.ToSlash(dir))
+
+	var metadataFiles []*chart.File
+	for _, file := range files {
+		fileDir, fileName := path.Split(file.Name)
+		if path.Clean(fileDir) != dir {
+			continue
+		}
+
+		if fileName == HelpersFileName {
+			mp.Helpers = string(file.Data)
+			continue
+		}
+
+		ver, direction, format, ok := parseMigrationFileName(fileName)
+		if !ok {
+			if _, _, ok = parseMetadataFileName(fileName); ok {
+				metadataFiles = append(metadataFiles, file)
+			}
+			continue
+		}
+
+		idx := slices.IndexFunc(mp.Migrations, func(m Migration) bool { return m.Direction == direction && m.Version.Equal(ver) })
+		if idx != -1 {
+			return nil, fmt.Errorf("found multiple %s migrations for version %s: '%s' and '%s'", direction, ver, mp.Migrations[idx].Name, fileName)
+		}
+
+		mp.Migrations = append(mp.Migrations, Migration{
+			Version:   ver,
+			Direction: direction,
+			Name:      fileName,
+			Format:    format,
+			Content:   string(file.Data),
+		})
 	}
 
-	return data, nil
+	// Metadata files without a migration are ignored
+	for _, file := range metadataFiles {
+		fileName := path.Base(file.Name)
+		ver, direction, _ := parseMetadataFileName(fileName)
+		idx := slices.IndexFunc(mp.Migrations, func(m Migration) bool { return m.Direction == direction && m.Version.Equal(ver) })
+		if idx == -1 {
+			continue
+		}
+		if mp.Migrations[idx].Metadata != nil {
+			return nil, fmt.Errorf("found multiple metadata files for the %s migration for version %s", direction, ver)
+		}
+
+		metadata, err := parseMigrationMetadata(string(file.Data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fileName, err)
+		}
+		mp.Migrations[idx].Metadata = metadata
+	}
+
+	return mp, nil
 }
 
-func (m *MemoryMigrationProvider) GetVersions() iter.Seq[int] {
-	return maps.Keys(m.VersionDataMap)
+func (m *MemoryMigrationProvider) GetMigrationFor(v *semver.Version, d Direction) (*Migration, error) {
+	idx := slices.IndexFunc(m.Migrations, func(m Migration) bool { return m.Direction == d && m.Version.Equal(v) })
+	if idx == -1 {
+		return nil, fmt.Errorf("no %s migration found for version %s", d, v)
+	}
+
+	migration := m.Migrations[idx]
+	migration.Helpers = m.Helpers
+	return &migration, nil
 }
 
-func (m *MemoryMigrationProvider) AddMigrationData(v int, data map[string]interface{}) {
-	if m.VersionDataMap == nil {
-		m.VersionDataMap = make(map[int]string)
+func (m *MemoryMigrationProvider) GetVersions(d Direction) iter.Seq[*semver.Version] {
+	return func(yield func(*semver.Version) bool) {
+		for _, migration := range m.Migrations {
+			if migration.Direction == d && !yield(migration.Version) {
+				return
+			}
+		}
 	}
+}
 
+func (m *MemoryMigrationProvider) AddMigrationData(v *semver.Version, data map[string]interface{}) {
 	dataM, _ := yaml.Marshal(data)
 
-	m.VersionDataMap[v] = string(dataM)
+	m.AddMigrationTemplate(v, string(dataM))
+}
+
+func (m *MemoryMigrationProvider) AddMigrationTemplate(v *semver.Version, mTemplate string) {
+	m.AddMigration(v, TemplateFormat, mTemplate)
+}
+
+func (m *MemoryMigrationProvider) AddMigration(v *semver.Version, format MigrationFormat, content string) {
+	m.addMigration(v, Up, fmt.Sprintf("to-v%s", v), format, content)
+}
+
+func (m *MemoryMigrationProvider) AddDownMigration(v *semver.Version, format MigrationFormat, content string) {
+	m.addMigration(v, Down, fmt.Sprintf("from-v%s", v), format, content)
+}
+
+func (m *MemoryMigrationProvider) addMigration(v *semver.Version, d Direction, name string, format MigrationFormat, content string) {
+	m.Migrations = slices.DeleteFunc(m.Migrations, func(m Migration) bool { return m.Direction == d && m.Version.Equal(v) })
+	m.Migrations = append(m.Migrations, Migration{
+		Version:   v,
+		Direction: d,
+		Name:      name,
+		Format:    format,
+		Content:   content,
+	})
 }
@@ -3,21 +3,34 @@ package pkg
 import (
 	"bytes"
 	"fmt"
+	"github.com/Masterminds/semver/v3"
 	"github.com/Masterminds/sprig/v3"
 	"gopkg.in/yaml.v2"
 	"os"
+	"regexp"
 	"slices"
 	"strings"
 	"text/template"
 )
 
-func MigrateFromPath(currentConfig map[string]interface{}, vFrom int, vTo *int, migrationsDir string, log Logger) (map[string]interface{}, error) {
+func MigrateFromPath(currentConfig map[string]interface{}, vFrom *semver.Version, vTo *semver.Version, migrationsDir string, log Logger) (map[string]interface{}, error) {
 
 	if len(currentConfig) == 0 {
 		log.Warning("No existing user-supplied values to migrate")
 		return nil, nil
 	}
 
+	mp, err := LoadMigrationsFromPath(migrationsDir, log)
+	if err != nil || mp == nil {
+		return nil, err
+	}
+
+	return Migrate(currentConfig, vFrom, vTo, mp, log)
+}
+
+// LoadMigrationsFromPath creates a provider for the migrations in the given directory. If the directory does not
+// exist, a warning is logged and nil is returned.
+func LoadMigrationsFromPath(migrationsDir string, log Logger) (MigrationProvider, error) {
 	info, err := os.Stat(migrationsDir)
 
 	if err != nil {
@@ -44,15 +57,67 @@ func MigrateFromPath(currentConfig map[string]interface{}, vFrom int, vTo *int,
 		return nil, fmt.Errorf("error creating migration provider: %w", err)
 	}
 
-	return Migrate(currentConfig, vFrom, vTo, mp, log)
+	return mp, nil
 }
 
-func Migrate(currentConfig map[string]interface{}, vFrom int, vTo *int, mp MigrationProvider, log Logger) (map[string]interface{}, error) {
+// Migrate applies, in version order, every migration with a version greater than vFrom and no greater than vTo. If vTo
+// is nil, all migrations after vFrom are applied. If vTo is lower than vFrom, the values are downgraded instead by
+// applying, in reverse version order, every down migration with a version no greater than vFrom and greater than vTo.
+func Migrate(currentConfig map[string]interface{}, vFrom *semver.Version, vTo *semver.Version, mp MigrationProvider, log Logger) (map[string]interface{}, error) {
+	result, err := NewMigrator(mp, log).Migrate(currentConfig, vFrom, vTo)
+	if err != nil || result == nil {
+		return nil, err
+	}
+
+	return result.Values, nil
+}
+
+// Migrator applies the migrations of a provider, recording each migration step that was applied.
+type Migrator struct {
+	Provider MigrationProvider
+	Log      Logger
+	// Params holds the values supplied for the parameters declared by migrations, by name. String values, such as those
+	// given with --param, are converted to the type of the parameter.
+	Params map[string]interface{}
+	// Prompt asks for the value of a required parameter that was not supplied. If it is nil, a *MissingParamsError
+	// listing every such parameter is returned instead.
+	Prompt func(param MigrationParam) (string, error)
+	// Environment describes the release and charts to migrations that use the full template context. If it is nil,
+	// those migrations see an empty release, no charts and the default capabilities.
+	Environment *MigrationEnvironment
+}
+
+func NewMigrator(mp MigrationProvider, log Logger) *Migrator {
+	return &Migrator{Provider: mp, Log: log}
+}
+
+// MigrationResult holds the migrated values along with the migration steps that produced them
+type MigrationResult struct {
+	Values map[string]interface{}
+	Steps  []MigrationStep
+}
+
+// MigrationStep is a migration that was applied, with the values it produced and how it changed them
+type MigrationStep struct {
+	Migration *Migration
+	Values    map[string]interface{}
+	Changes   ValuesDiff
+}
+
+// Migrate migrates the values in the same way as the package level Migrate function. The result is nil if the
+// provider has no migrations.
+func (mg *Migrator) Migrate(currentConfig map[string]interface{}, vFrom *semver.Version, vTo *semver.Version) (*MigrationResult, error) {
+	log, mp := mg.Log, mg.Provider
 
 	log.Debug("migrating user-supplied values")
-	versions := slices.Sorted(mp.GetVersions())
+	direction := Up
+	if vTo != nil && vTo.LessThan(vFrom) {
+		direction = Down
+		log.Debug("target version %s is lower than %s, downgrading values", vTo, vFrom)
+	}
 
-	if len(versions) == 0 {
+	versions := planMigrations(mp, vFrom, vTo, direction, log)
+	if versions == nil {
 		log.Warning("No migrations found")
 		return nil, nil
 	}
@@ -62,37 +127,185 @@ func Migrate(currentConfig map[string]interface{}, vFrom int, vTo *int, mp Migra
 		migratedConfig[key] = value
 	}
 
+	// Every migration is loaded before any are applied, so that all missing parameters are reported together
+	var migrations []*Migration
+	var params []map[string]interface{}
+	var missing []MissingParam
 	for _, version := range versions {
-		if version > vFrom {
-			if vTo != nil && version > *vTo {
-				break
-			}
+		log.Debug("loading %s migration for version: %s", direction, version)
+		m, err := mp.GetMigrationFor(version, direction)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving migration: %w", err)
+		}
+
+		if err = m.Metadata.checkPluginVersion(); err != nil {
+			return nil, fmt.Errorf("cannot apply migration %s: %w", m.Name, err)
+		}
+
+		mParams, mMissing, err := mg.resolveParams(m)
+		if err != nil {
+			return nil, err
+		}
 
-			log.Debug("loading migration template for version: %d", version)
-			mTemplate, err := mp.GetTemplateFor(version)
-			if err != nil {
-				return nil, fmt.Errorf("error retrieving migration template: %w", err)
+		migrations = append(migrations, m)
+		params = append(params, mParams)
+		// A parameter shared by several migrations is only listed once, as one value is used for all of them
+		for _, mm := range mMissing {
+			if !slices.ContainsFunc(missing, func(p MissingParam) bool { return p.Param.Name == mm.Param.Name }) {
+				missing = append(missing, mm)
 			}
+		}
+	}
+	if len(missing) > 0 {
+		return nil, &MissingParamsError{Params: missing}
+	}
 
-			log.Debug("applying migration template for version: %d", version)
-			migratedConfig, err = apply(migratedConfig, mTemplate)
-			if err != nil {
-				return nil, fmt.Errorf("error applying migration: %w", err)
+	result := &MigrationResult{}
+	for i, m := range migrations {
+		log.Debug("applying %s migration %s for version: %s", m.Format, m.Name, m.Version)
+		stepConfig, err := applyMigration(migratedConfig, m, params[i], mg.Environment)
+		if err != nil {
+			return nil, fmt.Errorf("error applying migration %s: %w", m.Name, err)
+		}
+
+		result.Steps = append(result.Steps, MigrationStep{
+			Migration: m,
+			Values:    stepConfig,
+			Changes:   DiffValues(migratedConfig, stepConfig),
+		})
+		migratedConfig = stepConfig
+	}
+
+	result.Values = migratedConfig
+	return result, nil
+}
+
+// planMigrations returns the versions of the migrations to apply in the order they should be applied, or nil if the
+// provider has no migrations at all in the given direction.
+func planMigrations(mp MigrationProvider, vFrom *semver.Version, vTo *semver.Version, direction Direction, log Logger) []*semver.Version {
+	available := slices.SortedFunc(mp.GetVersions(direction), (*semver.Version).Compare)
+	if len(available) == 0 {
+		return nil
+	}
+
+	if direction == Up {
+		// A pre-release is earlier than its release, so the migration to the release is not applied to it
+		if vTo != nil && vTo.Prerelease() != "" {
+			release, _ := vTo.SetPrerelease("")
+			if release.GreaterThan(vFrom) && slices.ContainsFunc(available, release.Equal) {
+				log.Warning("The migration to version %s is not applied to the pre-release %s. Name it after the first pre-release that needs it, e.g. to-v%s, to apply it to the pre-releases as well", release.String(), vTo, vTo)
 			}
 		}
+
+		return slices.DeleteFunc(available, func(v *semver.Version) bool {
+			return !v.GreaterThan(vFrom) || (vTo != nil && v.GreaterThan(vTo))
+		})
 	}
 
-	return migratedConfig, nil
+	inRange := func(v *semver.Version) bool { return !v.GreaterThan(vFrom) && v.GreaterThan(vTo) }
+
+	for v := range mp.GetVersions(Up) {
+		if inRange(v) && !slices.ContainsFunc(available, v.Equal) {
+			log.Warning("No down migration found for version %s, the values may not be valid for version %s", v, vTo)
+		}
+	}
+
+	versions := slices.DeleteFunc(available, func(v *semver.Version) bool { return !inRange(v) })
+	slices.Reverse(versions)
+	return versions
+}
+
+// MigrationMode controls how the rendered output of a migration template is combined with the values being migrated.
+type MigrationMode string
+
+const (
+	// ReplaceMode uses the rendered template as the complete set of migrated values. This is the default, so that
+	// existing migrations keep their behaviour.
+	ReplaceMode MigrationMode = "replace"
+	// MergeMode deep-merges the rendered template over the values being migrated, so a migration only has to describe
+	// what changed. Keys rendered as null are removed.
+	MergeMode MigrationMode = "merge"
+)
+
+// A migration file selects its mode with a comment line, e.g. "# migration-mode: merge"
+var migrationModeRegEx = regexp.MustCompile(`^#\s*migration-mode:\s*(\S+)\s*$`)
+
+// migrationModeOf returns the mode selected in the leading comment lines of the migration template. Comments further
+// down, e.g. within a block scalar, are part of the values and do not select a mode.
+func migrationModeOf(mTemplate string) (MigrationMode, error) {
+	var matches []string
+	for _, line := range strings.Split(mTemplate, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		if matches = migrationModeRegEx.FindStringSubmatch(line); matches != nil {
+			break
+		}
+	}
+	if len(matches) < 2 {
+		return ReplaceMode, nil
+	}
+
+	switch mode := MigrationMode(matches[1]); mode {
+	case ReplaceMode, MergeMode:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown migration mode '%s', expected '%s' or '%s'", mode, ReplaceMode, MergeMode)
+	}
+}
+
+// applyMigration applies the migration to the values. Only template migrations can read the parameters and environment.
+func applyMigration(valuesData map[string]interface{}, m *Migration, params map[string]interface{}, env *MigrationEnvironment) (map[string]interface{}, error) {
+	switch m.Format {
+	case TemplateFormat:
+		return apply(valuesData, m, params, env)
+	case OperationsFormat:
+		return applyOperations(valuesData, m.Content)
+	case JSONPatchFormat:
+		return applyJSONPatch(valuesData, m.Content)
+	case MergePatchFormat:
+		return applyMergePatch(valuesData, m.Content)
+	default:
+		return nil, fmt.Errorf("unsupported migration format '%s'", m.Format)
+	}
 }
 
-func apply(valuesData map[string]interface{}, mTemplate string) (map[string]interface{}, error) {
-	parsedTemplate, err := template.New("migration").Funcs(extraFuncs()).Parse(mTemplate)
+// apply executes the migration template with the values. If the migration declares parameters, the template reads them
+// as .Params alongside the values. A migration that opts in to the full template context is instead executed with a
+// TemplateContext.
+func apply(valuesData map[string]interface{}, m *Migration, params map[string]interface{}, env *MigrationEnvironment) (map[string]interface{}, error) {
+	mode, err := migrationModeOf(m.Content)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing migration template: %w", err)
+		return nil, err
+	}
+
+	parsedTemplate, err := parseMigrationTemplate(m.Content, m.Helpers)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nested maps are normalized so that sprig's dict functions, such as dig and hasKey, can be used on them
+	values := normalizeMap(valuesData)
+	var data interface{} = values
+	if m.Metadata.templateContextMode() == FullTemplateContext {
+		data = newTemplateContext(values, params, m, env)
+	} else if params != nil {
+		if _, exists := values[paramsKey]; exists {
+			return nil, fmt.Errorf("the values have a top-level %s key, which is hidden by the migration's parameters", paramsKey)
+		}
+		if values == nil {
+			values = make(map[string]interface{})
+		}
+		values[paramsKey] = params
+		data = values
 	}
 
 	var renderedMigrationBuf bytes.Buffer
-	err = parsedTemplate.Execute(&renderedMigrationBuf, valuesData)
+	err = parsedTemplate.Execute(&renderedMigrationBuf, data)
 	if err != nil {
 		return nil, fmt.Errorf("error executing migration template: %w", err)
 	}
@@ -103,10 +316,37 @@ func apply(valuesData map[string]interface{}, mTemplate string) (map[string]inte
 		return nil, fmt.Errorf("error parsing migrated yaml values %w", err)
 	}
 
+	if mode == MergeMode {
+		return mergeValues(valuesData, migratedConfig), nil
+	}
+
 	return migratedConfig, nil
 }
 
+// parseMigrationTemplate parses the migration template, along with the partials shared by the migrations in its
+// directory, which it can use with include or template
+func parseMigrationTemplate(mTemplate string, helpers string) (*template.Template, error) {
+	parsedTemplate := template.New("migration")
+	includedNames := make(map[string]int)
+	funcs := extraFuncs()
+	funcs["include"] = includeFunc(parsedTemplate, includedNames)
+	funcs["tpl"] = tplFunc(parsedTemplate, includedNames)
+	parsedTemplate.Funcs(funcs)
+
+	if helpers != "" {
+		if _, err := parsedTemplate.New(HelpersFileName).Parse(helpers); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", HelpersFileName, err)
+		}
+	}
+
+	if _, err := parsedTemplate.Parse(mTemplate); err != nil {
+		return nil, fmt.Errorf("error parsing migration template: %w", err)
+	}
+	return parsedTemplate, nil
+}
+
 // Modified from https://github.com/helm/helm/blob/2feac15cc3252c97c997be2ced1ab8afe314b429/pkg/engine/funcs.go#L43
+// Sprig's fail function is kept, as in Helm. include and tpl are added when the template is parsed.
 func extraFuncs() template.FuncMap {
 	f := sprig.TxtFuncMap()
 	delete(f, "env")
@@ -114,6 +354,13 @@ func extraFuncs() template.FuncMap {
 
 	f["quoteEach"] = quoteEach
 	f["toYaml"] = toYaml
+	f["fromYaml"] = fromYaml
+	f["fromYamlArray"] = fromYamlArray
+	f["toJson"] = toJson
+	f["fromJson"] = fromJson
+	f["fromJsonArray"] = fromJsonArray
+	f["toToml"] = toToml
+	f["required"] = required
 
 	return f
 }
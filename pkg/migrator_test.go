@@ -1,8 +1,11 @@
 package pkg
 
 import (
+	"github.com/Masterminds/semver/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	"iter"
 	"testing"
 )
 
@@ -76,7 +79,7 @@ func TestMigrator_MigrateAcrossVersions(t *testing.T) {
 
 			ms := loadMigrationsToVersions(tc.includeMigrationsToVersions)
 
-			migrated, err := Migrate(currentConfig, tc.currentVersion, tc.versionTo, ms, *NewLogger(false))
+			migrated, err := Migrate(currentConfig, majorVersion(tc.currentVersion), majorVersionPtr(tc.versionTo), ms, *NewLogger(false))
 			req.NoError(err)
 
 			is.EqualValues(tc.expected, migrated)
@@ -88,12 +91,23 @@ func ptr[K any](val K) *K {
 	return &val
 }
 
+func majorVersion(major int) *semver.Version {
+	return semver.New(uint64(major), 0, 0, "", "")
+}
+
+func majorVersionPtr(major *int) *semver.Version {
+	if major == nil {
+		return nil
+	}
+	return majorVersion(*major)
+}
+
 func loadMigrationsToVersions(versions []int) MigrationProvider {
 	mp := &MemoryMigrationProvider{}
 	for _, v := range versions {
 		m, ok := migrationData[v]
 		if ok {
-			mp.AddMigrationData(v, m)
+			mp.AddMigrationData(majorVersion(v), m)
 		}
 	}
 	return mp
@@ -153,3 +167,351 @@ var version4Migration = map[string]interface{}{
 		},
 	},
 }
+
+var mergeModeTestCases = []struct {
+	name      string
+	current   map[string]interface{}
+	migration string
+	expected  map[string]interface{}
+}{
+	{
+		name: "untouched keys are carried forward",
+		current: map[string]interface{}{
+			"myKey": "myValue",
+			"agent": map[string]interface{}{
+				"targetEnvironment": "test",
+				"name":              "my-agent",
+			},
+		},
+		migration: `# migration-mode: merge
+agent:
+  targetEnvironments: [{{ .agent.targetEnvironment | quote }}]
+  targetEnvironment: null
+`,
+		expected: map[string]interface{}{
+			"myKey": "myValue",
+			"agent": map[string]interface{}{
+				"targetEnvironments": []interface{}{"test"},
+				"name":               "my-agent",
+			},
+		},
+	},
+	{
+		name: "removal markers remove whole sub-trees",
+		current: map[string]interface{}{
+			"myKey": "myValue",
+			"legacy": map[interface{}]interface{}{
+				"enabled": true,
+			},
+		},
+		migration: `# migration-mode: merge
+legacy: null
+`,
+		expected: map[string]interface{}{
+			"myKey": "myValue",
+		},
+	},
+	{
+		name: "lists are replaced rather than merged",
+		current: map[string]interface{}{
+			"environments": []interface{}{"a", "b"},
+		},
+		migration: `# migration-mode: merge
+environments: [c]
+`,
+		expected: map[string]interface{}{
+			"environments": []interface{}{"c"},
+		},
+	},
+	{
+		name: "removal markers for missing keys are ignored",
+		current: map[string]interface{}{
+			"myKey": "myValue",
+		},
+		migration: `# migration-mode: merge
+agent:
+  name: my-agent
+  missing: null
+`,
+		expected: map[string]interface{}{
+			"myKey": "myValue",
+			"agent": map[string]interface{}{
+				"name": "my-agent",
+			},
+		},
+	},
+	{
+		name: "mode is read from any of the leading comment lines",
+		current: map[string]interface{}{
+			"myKey": "myValue",
+		},
+		migration: `# Adds the agent name
+
+# migration-mode: merge
+agent:
+  name: my-agent
+`,
+		expected: map[string]interface{}{
+			"myKey": "myValue",
+			"agent": map[string]interface{}{
+				"name": "my-agent",
+			},
+		},
+	},
+	{
+		name: "mode comments after the leading comment lines are ignored",
+		current: map[string]interface{}{
+			"myKey": "myValue",
+			"other": "value",
+		},
+		migration: `myKey: {{ .myKey }}
+script: |
+  # migration-mode: merge
+`,
+		expected: map[string]interface{}{
+			"myKey":  "myValue",
+			"script": "# migration-mode: merge\n",
+		},
+	},
+	{
+		name: "replace mode drops keys that are not restated",
+		current: map[string]interface{}{
+			"myKey": "myValue",
+			"other": "value",
+		},
+		migration: `# migration-mode: replace
+myKey: {{ .myKey }}
+`,
+		expected: map[string]interface{}{
+			"myKey": "myValue",
+		},
+	},
+}
+
+func TestMigrator_MergeMode(t *testing.T) {
+	for _, tc := range mergeModeTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := assert.New(t)
+			req := require.New(t)
+
+			mp := &MemoryMigrationProvider{}
+			mp.AddMigrationTemplate(majorVersion(2), tc.migration)
+
+			migrated, err := Migrate(tc.current, majorVersion(1), nil, mp, *NewLogger(false))
+			req.NoError(err)
+
+			is.EqualValues(tc.expected, migrated)
+		})
+	}
+}
+
+func TestMigrator_UnknownMigrationMode(t *testing.T) {
+	mp := &MemoryMigrationProvider{}
+	mp.AddMigrationTemplate(majorVersion(2), "# migration-mode: patch\nmyKey: value\n")
+
+	_, err := Migrate(map[string]interface{}{"myKey": "myValue"}, majorVersion(1), nil, mp, *NewLogger(false))
+	require.ErrorContains(t, err, "unknown migration mode 'patch'")
+}
+
+var semanticVersionTestCases = []struct {
+	name     string
+	from     string
+	to       *string
+	expected string
+}{
+	{
+		name:     "minor versions of a 0.x chart",
+		from:     "0.6.3",
+		to:       ptr("0.8.1"),
+		expected: "start,0.7.0,0.8.0",
+	},
+	{
+		name:     "pre-releases are ordered before their release",
+		from:     "0.7.0",
+		to:       ptr("2.0.0-beta.2"),
+		expected: "start,0.8.0,1.0.0,2.0.0-beta.1",
+	},
+	{
+		name:     "from a pre-release",
+		from:     "2.0.0-beta.1",
+		to:       ptr("2.5.0"),
+		expected: "start,2.0.0,2.3.0",
+	},
+	{
+		name:     "pre-releases are before the migration to their release",
+		from:     "2.3.0",
+		to:       ptr("3.0.0-rc.1"),
+		expected: "start",
+	},
+	{
+		name:     "migrations named after a pre-release are applied to the release",
+		from:     "1.2.0",
+		to:       ptr("2.0.0"),
+		expected: "start,2.0.0-beta.1,2.0.0",
+	},
+	{
+		name:     "patch releases without migrations",
+		from:     "2.3.0",
+		to:       ptr("2.3.4"),
+		expected: "start",
+	},
+	{
+		name:     "no end version",
+		from:     "1.2.0",
+		to:       nil,
+		expected: "start,2.0.0-beta.1,2.0.0,2.3.0,3.0.0",
+	},
+}
+
+func TestMigrator_SemanticVersions(t *testing.T) {
+	mp := &MemoryMigrationProvider{}
+	// Added out of order on purpose
+	for _, v := range []string{"3", "2.3.0", "0.8", "2.0.0-beta.1", "1", "0.7", "2.0.0"} {
+		ver := semver.MustParse(v)
+		mp.AddMigrationTemplate(ver, `applied: "{{ .applied }},`+ver.String()+`"`)
+	}
+
+	for _, tc := range semanticVersionTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var to *semver.Version
+			if tc.to != nil {
+				to = semver.MustParse(*tc.to)
+			}
+
+			migrated, err := Migrate(map[string]interface{}{"applied": "start"}, semver.MustParse(tc.from), to, mp, *NewLogger(false))
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expected, migrated["applied"])
+		})
+	}
+}
+
+var migrationFileNameTestCases = []struct {
+	fileName          string
+	expectedVersion   string
+	expectedDirection Direction
+	expectedFormat    MigrationFormat
+}{
+	{fileName: "to-v2.yaml", expectedVersion: "2.0.0", expectedFormat: TemplateFormat},
+	{fileName: "to-v0.7.yml", expectedVersion: "0.7.0", expectedFormat: TemplateFormat},
+	{fileName: "to-v2.3.0.yaml", expectedVersion: "2.3.0", expectedFormat: TemplateFormat},
+	{fileName: "to-v2.0.0-beta.1.ops.yaml", expectedVersion: "2.0.0-beta.1", expectedFormat: OperationsFormat},
+	{fileName: "to-v3.patch.json", expectedVersion: "3.0.0", expectedFormat: JSONPatchFormat},
+	{fileName: "to-v3.1.merge.yaml", expectedVersion: "3.1.0", expectedFormat: MergePatchFormat},
+	{fileName: "from-v2.yaml", expectedVersion: "2.0.0", expectedDirection: Down, expectedFormat: TemplateFormat},
+	{fileName: "from-v0.7.patch.yaml", expectedVersion: "0.7.0", expectedDirection: Down, expectedFormat: JSONPatchFormat},
+	{fileName: "to-v3.json"},
+	{fileName: "to-v3.ops.json"},
+	{fileName: "to-vnext.yaml"},
+	{fileName: "values.yaml"},
+}
+
+func TestMigrations_ParseMigrationFileName(t *testing.T) {
+	for _, tc := range migrationFileNameTestCases {
+		t.Run(tc.fileName, func(t *testing.T) {
+			version, direction, format, ok := parseMigrationFileName(tc.fileName)
+			if tc.expectedVersion == "" {
+				assert.False(t, ok)
+				return
+			}
+
+			require.True(t, ok)
+			assert.Equal(t, tc.expectedVersion, version.String())
+			assert.Equal(t, tc.expectedDirection, direction)
+			assert.Equal(t, tc.expectedFormat, format)
+		})
+	}
+}
+
+var downgradeTestCases = []struct {
+	name     string
+	from     string
+	to       string
+	expected map[string]interface{}
+}{
+	{
+		name:     "downgrade across a single version",
+		from:     "4.1.0",
+		to:       "3.2.0",
+		expected: version3Config,
+	},
+	{
+		name:     "downgrade across multiple versions",
+		from:     "4.0.0",
+		to:       "2.5.0",
+		expected: version2Config,
+	},
+	{
+		name: "downgrade within the same schema version",
+		from: "4.2.0",
+		to:   "4.0.0",
+		expected: map[string]interface{}{
+			"agent": map[string]interface{}{
+				"target": map[string]interface{}{
+					"environments": []interface{}{"test"},
+				},
+			},
+		},
+	},
+}
+
+func TestMigrator_Downgrade(t *testing.T) {
+	mp := &MemoryMigrationProvider{}
+	mp.AddMigrationData(majorVersion(3), version3Migration)
+	mp.AddMigrationData(majorVersion(4), version4Migration)
+	mp.AddDownMigration(majorVersion(4), OperationsFormat, `
+- op: move
+  from: agent.target.environments
+  path: agent.targetEnvironments
+- op: delete
+  path: agent.target
+`)
+	mp.AddDownMigration(majorVersion(3), TemplateFormat, `agent:
+  targetEnvironment: {{ first .agent.targetEnvironments }}
+`)
+
+	current := map[string]interface{}{
+		"agent": map[string]interface{}{
+			"target": map[string]interface{}{
+				"environments": []interface{}{"test"},
+			},
+		},
+	}
+
+	for _, tc := range downgradeTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			migrated, err := Migrate(current, semver.MustParse(tc.from), semver.MustParse(tc.to), mp, *NewLogger(false))
+			require.NoError(t, err)
+
+			assert.EqualValues(t, normalizeMap(tc.expected), normalizeMap(migrated))
+		})
+	}
+}
+
+func TestMigrator_ChartFilesMigrationProvider(t *testing.T) {
+	files := []*chart.File{
+		{Name: "values.schema.json", Data: []byte("{}")},
+		{Name: "value-migrations/to-v2.yaml", Data: []byte("{}")},
+		{Name: "value-migrations/from-v2.ops.yaml", Data: []byte("[]")},
+		{Name: "value-migrations/tests/to-v3.yaml", Data: []byte("{}")},
+	}
+
+	mp, err := NewChartFilesMigrationProvider(files, "value-migrations/")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"2.0.0"}, versionStrings(mp.GetVersions(Up)))
+	assert.Equal(t, []string{"2.0.0"}, versionStrings(mp.GetVersions(Down)))
+
+	m, err := mp.GetMigrationFor(majorVersion(2), Down)
+	require.NoError(t, err)
+	assert.Equal(t, "from-v2.ops.yaml", m.Name)
+	assert.Equal(t, OperationsFormat, m.Format)
+}
+
+func versionStrings(versions iter.Seq[*semver.Version]) []string {
+	var result []string
+	for v := range versions {
+		result = append(result, v.String())
+	}
+	return result
+}
@@ -0,0 +1,154 @@
+package pkg
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+)
+
+// Operation is a single step of a declarative migration. Paths are either dotted paths (agent.target.environments) or
+// JSON pointers (/agent/target/environments).
+type Operation struct {
+	Op    string      `yaml:"op"`
+	Path  string      `yaml:"path"`
+	From  string      `yaml:"from,omitempty"`
+	To    string      `yaml:"to,omitempty"`
+	Value interface{} `yaml:"value,omitempty"`
+}
+
+const (
+	moveOp       = "move"
+	copyOp       = "copy"
+	deleteOp     = "delete"
+	setOp        = "set"
+	setDefaultOp = "setDefault"
+	toListOp     = "toList"
+	renameKeyOp  = "renameKey"
+)
+
+func parseOperations(content string) ([]Operation, error) {
+	var operations []Operation
+	if err := yaml.UnmarshalStrict([]byte(content), &operations); err != nil {
+		return nil, fmt.Errorf("error parsing migration operations: %w", err)
+	}
+
+	for i, op := range operations {
+		if err := op.validate(); err != nil {
+			return nil, fmt.Errorf("operation %d (%s): %w", i+1, op.Op, err)
+		}
+	}
+
+	return operations, nil
+}
+
+func applyOperations(valuesData map[string]interface{}, content string) (map[string]interface{}, error) {
+	operations, err := parseOperations(content)
+	if err != nil {
+		return nil, err
+	}
+
+	migratedConfig := normalizeMap(valuesData)
+	if migratedConfig == nil {
+		migratedConfig = make(map[string]interface{})
+	}
+
+	for i, op := range operations {
+		if err := op.apply(migratedConfig); err != nil {
+			return nil, fmt.Errorf("operation %d (%s): %w", i+1, op.Op, err)
+		}
+	}
+
+	return migratedConfig, nil
+}
+
+func (o Operation) validate() error {
+	if _, err := parseValuePath(o.Path); err != nil {
+		return fmt.Errorf("invalid path: %w", err)
+	}
+
+	switch o.Op {
+	case moveOp, copyOp:
+		if _, err := parseValuePath(o.From); err != nil {
+			return fmt.Errorf("invalid from path: %w", err)
+		}
+	case renameKeyOp:
+		if o.To == "" {
+			return fmt.Errorf("the new key name must be set with 'to'")
+		}
+	case deleteOp, setOp, setDefaultOp, toListOp:
+	default:
+		return fmt.Errorf("unknown operation '%s'", o.Op)
+	}
+	return nil
+}
+
+func (o Operation) apply(values map[string]interface{}) error {
+	path, err := parseValuePath(o.Path)
+	if err != nil {
+		return err
+	}
+
+	switch o.Op {
+	case moveOp, copyOp:
+		from, err := parseValuePath(o.From)
+		if err != nil {
+			return err
+		}
+		if o.Op == moveOp && from.isPrefixOf(path) {
+			return fmt.Errorf("cannot move '%s' into itself at '%s'", from, path)
+		}
+
+		value, found, err := from.lookup(values)
+		if err != nil || !found {
+			return err
+		}
+		if o.Op == moveOp {
+			if _, err := from.remove(values); err != nil {
+				return err
+			}
+		}
+		return path.set(values, normalizeValue(value))
+
+	case deleteOp:
+		_, err := path.remove(values)
+		return err
+
+	case setOp:
+		return path.set(values, normalizeValue(o.Value))
+
+	case setDefaultOp:
+		_, found, err := path.lookup(values)
+		if err != nil || found {
+			return err
+		}
+		return path.set(values, normalizeValue(o.Value))
+
+	case toListOp:
+		value, found, err := path.lookup(values)
+		if err != nil || !found {
+			return err
+		}
+		if _, isList := value.([]interface{}); isList {
+			return nil
+		}
+		return path.set(values, []interface{}{value})
+
+	case renameKeyOp:
+		value, found, err := path.lookup(values)
+		if err != nil || !found {
+			return err
+		}
+		parent, err := path.parent().container(values, false)
+		if err != nil {
+			return err
+		}
+		parentMap, ok := parent.(map[string]interface{})
+		if !ok {
+			return path.parent().typeError(parent, "a map")
+		}
+		delete(parentMap, path.last())
+		parentMap[o.To] = value
+		return nil
+	}
+
+	return fmt.Errorf("unknown operation '%s'", o.Op)
+}
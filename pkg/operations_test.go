@@ -0,0 +1,321 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var operationsTestCases = []struct {
+	name       string
+	current    map[string]interface{}
+	operations string
+	expected   map[string]interface{}
+}{
+	{
+		name: "move a value to a new nested path",
+		current: map[string]interface{}{
+			"myKey": "myValue",
+			"agent": map[interface{}]interface{}{
+				"targetEnvironment": "test",
+			},
+		},
+		operations: `
+- op: move
+  from: agent.targetEnvironment
+  path: agent.target.environments
+- op: toList
+  path: agent.target.environments
+`,
+		expected: map[string]interface{}{
+			"myKey": "myValue",
+			"agent": map[string]interface{}{
+				"target": map[string]interface{}{
+					"environments": []interface{}{"test"},
+				},
+			},
+		},
+	},
+	{
+		name: "move a missing value does nothing",
+		current: map[string]interface{}{
+			"myKey": "myValue",
+		},
+		operations: `
+- op: move
+  from: agent.targetEnvironment
+  path: agent.target.environments
+`,
+		expected: map[string]interface{}{
+			"myKey": "myValue",
+		},
+	},
+	{
+		name: "copy a value using JSON pointers",
+		current: map[string]interface{}{
+			"image": map[string]interface{}{
+				"tag": "1.0.0",
+			},
+		},
+		operations: `
+- op: copy
+  from: /image/tag
+  path: /sidecar/image~1tag
+`,
+		expected: map[string]interface{}{
+			"image": map[string]interface{}{
+				"tag": "1.0.0",
+			},
+			"sidecar": map[string]interface{}{
+				"image/tag": "1.0.0",
+			},
+		},
+	},
+	{
+		name: "delete, set and setDefault",
+		current: map[string]interface{}{
+			"legacy":   true,
+			"replicas": 3,
+			"service":  map[string]interface{}{"port": 80},
+		},
+		operations: `
+- op: delete
+  path: legacy
+- op: set
+  path: service.type
+  value: ClusterIP
+- op: setDefault
+  path: service.port
+  value: 8080
+- op: setDefault
+  path: service.annotations
+  value:
+    team: octopus
+`,
+		expected: map[string]interface{}{
+			"replicas": 3,
+			"service": map[string]interface{}{
+				"port": 80,
+				"type": "ClusterIP",
+				"annotations": map[string]interface{}{
+					"team": "octopus",
+				},
+			},
+		},
+	},
+	{
+		name: "toList leaves existing lists alone",
+		current: map[string]interface{}{
+			"environments": []interface{}{"a", "b"},
+		},
+		operations: `
+- op: toList
+  path: environments
+`,
+		expected: map[string]interface{}{
+			"environments": []interface{}{"a", "b"},
+		},
+	},
+	{
+		name: "renameKey keeps the value in place",
+		current: map[string]interface{}{
+			"agent": map[string]interface{}{
+				"targetEnvironment": "test",
+				"name":              "my-agent",
+			},
+		},
+		operations: `
+- op: renameKey
+  path: agent.targetEnvironment
+  to: targetEnvironments
+`,
+		expected: map[string]interface{}{
+			"agent": map[string]interface{}{
+				"targetEnvironments": "test",
+				"name":               "my-agent",
+			},
+		},
+	},
+	{
+		name: "list items are addressed by index",
+		current: map[string]interface{}{
+			"hosts": []interface{}{
+				map[string]interface{}{"name": "a"},
+				map[string]interface{}{"name": "b"},
+			},
+		},
+		operations: `
+- op: renameKey
+  path: hosts.1.name
+  to: host
+- op: delete
+  path: hosts.0
+`,
+		expected: map[string]interface{}{
+			"hosts": []interface{}{
+				map[string]interface{}{"host": "b"},
+			},
+		},
+	},
+	{
+		name: "escaped dots are part of the key",
+		current: map[string]interface{}{
+			"podAnnotations": map[string]interface{}{
+				"octopus.com/team": "a",
+			},
+		},
+		operations: `
+- op: move
+  from: podAnnotations.octopus\.com/team
+  path: podLabels.team
+`,
+		expected: map[string]interface{}{
+			"podAnnotations": map[string]interface{}{},
+			"podLabels": map[string]interface{}{
+				"team": "a",
+			},
+		},
+	},
+}
+
+func TestOperations_Apply(t *testing.T) {
+	for _, tc := range operationsTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := assert.New(t)
+			req := require.New(t)
+
+			migrated, err := applyOperations(tc.current, tc.operations)
+			req.NoError(err)
+
+			is.EqualValues(tc.expected, migrated)
+		})
+	}
+}
+
+var operationsErrorTestCases = []struct {
+	name        string
+	operations  string
+	expectedErr string
+}{
+	{
+		name: "source path traverses a scalar",
+		operations: `
+- op: move
+  from: agent.name.first
+  path: agent.firstName
+`,
+		expectedErr: "operation 1 (move): 'agent.name' is a string, expected a map or list",
+	},
+	{
+		name: "destination path traverses a scalar",
+		operations: `
+- op: set
+  path: agent.name.first
+  value: x
+`,
+		expectedErr: "operation 1 (set): 'agent.name' is a string, expected a map or list",
+	},
+	{
+		name: "renameKey inside a list",
+		operations: `
+- op: renameKey
+  path: agent.environments.0
+  to: first
+`,
+		expectedErr: "operation 1 (renameKey): 'agent.environments' is a list, expected a map",
+	},
+	{
+		name: "invalid list index",
+		operations: `
+- op: delete
+  path: agent.environments.first
+`,
+		expectedErr: "operation 1 (delete): 'first' is not a valid list index at 'agent.environments.first'",
+	},
+	{
+		name: "unknown operation",
+		operations: `
+- op: explode
+  path: agent
+`,
+		expectedErr: "operation 1 (explode): unknown operation 'explode'",
+	},
+	{
+		name: "missing from path",
+		operations: `
+- op: copy
+  path: agent
+`,
+		expectedErr: "operation 1 (copy): invalid from path: path must not be empty",
+	},
+	{
+		name: "move into itself",
+		operations: `
+- op: move
+  from: agent
+  path: agent.nested
+`,
+		expectedErr: "operation 1 (move): cannot move 'agent' into itself at 'agent.nested'",
+	},
+}
+
+func TestOperations_Errors(t *testing.T) {
+	current := map[string]interface{}{
+		"agent": map[string]interface{}{
+			"name":         "my-agent",
+			"environments": []interface{}{"test"},
+		},
+	}
+
+	for _, tc := range operationsErrorTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := applyOperations(current, tc.operations)
+			require.EqualError(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestMigrator_MixedMigrationFormats(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+
+	dir := t.TempDir()
+	writeMigrationFile(t, dir, "to-v3.yaml", `agent:
+  targetEnvironments: [{{ .agent.targetEnvironment | quote }}]
+`)
+	writeMigrationFile(t, dir, "to-v4.ops.yaml", `
+- op: move
+  from: agent.targetEnvironments
+  path: agent.target.environments
+`)
+
+	mp, err := NewFileSystemMigrationProvider(dir)
+	req.NoError(err)
+
+	migrated, err := Migrate(version1Config, majorVersion(1), nil, mp, *NewLogger(false))
+	req.NoError(err)
+
+	is.EqualValues(map[string]interface{}{
+		"agent": map[string]interface{}{
+			"target": map[string]interface{}{
+				"environments": []interface{}{"test"},
+			},
+		},
+	}, migrated)
+}
+
+func TestMigrator_DuplicateMigrationVersions(t *testing.T) {
+	dir := t.TempDir()
+	writeMigrationFile(t, dir, "to-v2.yaml", "{}")
+	writeMigrationFile(t, dir, "to-v2.ops.yaml", "[]")
+
+	_, err := NewFileSystemMigrationProvider(dir)
+	require.ErrorContains(t, err, "found multiple up migrations for version 2.0.0")
+}
+
+func writeMigrationFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+}
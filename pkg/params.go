@@ -0,0 +1,213 @@
+package pkg
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParamType is the type of a migration parameter's value
+type ParamType string
+
+const (
+	StringParam  ParamType = "string"
+	IntegerParam ParamType = "integer"
+	NumberParam  ParamType = "number"
+	BooleanParam ParamType = "boolean"
+)
+
+// paramsKey is the key that template migrations read their parameters from, e.g. {{ .Params.storageClass }}
+const paramsKey = "Params"
+
+// Parameter names must be usable as a template field, e.g. .Params.storageClass
+var paramNameRegEx = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// MigrationParam is a value that a migration cannot infer from the values being migrated, such as the choice of a new
+// setting. Parameters are declared in the migration's metadata file, and template migrations read them as .Params.
+type MigrationParam struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	// Type is a string if it is not set
+	Type ParamType `yaml:"type"`
+	// Default is used when no value is supplied. A parameter without a default must be supplied.
+	Default interface{} `yaml:"default"`
+}
+
+func (p MigrationParam) Required() bool {
+	return p.Default == nil
+}
+
+func (p MigrationParam) typeOrDefault() ParamType {
+	if p.Type == "" {
+		return StringParam
+	}
+	return p.Type
+}
+
+func (p MigrationParam) validate() error {
+	if !paramNameRegEx.MatchString(p.Name) {
+		return fmt.Errorf("invalid parameter name '%s', names must start with a letter or underscore and contain only letters, digits and underscores", p.Name)
+	}
+
+	switch p.typeOrDefault() {
+	case StringParam, IntegerParam, NumberParam, BooleanParam:
+	default:
+		return fmt.Errorf("parameter %s has unknown type '%s', expected '%s', '%s', '%s' or '%s'", p.Name, p.Type, StringParam, IntegerParam, NumberParam, BooleanParam)
+	}
+
+	if p.Default != nil {
+		if _, err := p.convert(p.Default); err != nil {
+			return fmt.Errorf("invalid default for parameter %s: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// convert returns the value as the parameter's type. Strings, such as those given with --param or typed at a prompt,
+// are parsed as the type.
+func (p MigrationParam) convert(value interface{}) (interface{}, error) {
+	paramType := p.typeOrDefault()
+	if s, ok := value.(string); ok {
+		switch paramType {
+		case StringParam:
+			return s, nil
+		case IntegerParam:
+			i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("'%s' is not an integer", s)
+			}
+			return int(i), nil
+		case NumberParam:
+			f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				return nil, fmt.Errorf("'%s' is not a number", s)
+			}
+			return f, nil
+		case BooleanParam:
+			b, err := strconv.ParseBool(strings.TrimSpace(s))
+			if err != nil {
+				return nil, fmt.Errorf("'%s' is not a boolean", s)
+			}
+			return b, nil
+		}
+	}
+
+	switch v := value.(type) {
+	case int, int64, uint64:
+		switch paramType {
+		case StringParam:
+			return fmt.Sprint(v), nil
+		case IntegerParam, NumberParam:
+			return v, nil
+		}
+	case float64:
+		switch paramType {
+		case StringParam:
+			return fmt.Sprint(v), nil
+		case NumberParam:
+			return v, nil
+		}
+	case bool:
+		switch paramType {
+		case StringParam:
+			return strconv.FormatBool(v), nil
+		case BooleanParam:
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("expected a value of type %s, found %v", paramType, value)
+}
+
+// MissingParam is a required parameter of a migration that no value was supplied for
+type MissingParam struct {
+	Param     MigrationParam
+	Migration string
+}
+
+// MissingParamsError is returned when required migration parameters have no value and cannot be prompted for. It
+// lists every missing parameter, so that they can all be supplied at once.
+type MissingParamsError struct {
+	Params []MissingParam
+}
+
+func (e *MissingParamsError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("missing values for migration parameters, supply them with --param NAME=VALUE or --params-file:")
+	for _, missing := range e.Params {
+		_, _ = fmt.Fprintf(&sb, "\n  %s (%s, %s)", missing.Param.Name, missing.Param.typeOrDefault(), missing.Migration)
+		if missing.Param.Description != "" {
+			sb.WriteString(": " + strings.TrimSpace(missing.Param.Description))
+		}
+	}
+	return sb.String()
+}
+
+// resolveParams returns the values of the migration's parameters, by name. Supplied values are used first, then
+// defaults. Required parameters without a value are prompted for if possible, and otherwise returned as missing.
+func (mg *Migrator) resolveParams(m *Migration) (map[string]interface{}, []MissingParam, error) {
+	if m.Metadata == nil || len(m.Metadata.Params) == 0 {
+		return nil, nil, nil
+	}
+
+	params := make(map[string]interface{}, len(m.Metadata.Params))
+	var missing []MissingParam
+	for _, param := range m.Metadata.Params {
+		value, supplied := mg.Params[param.Name]
+		if !supplied && param.Required() && mg.Prompt != nil {
+			answer, err := mg.promptParam(param)
+			if err != nil {
+				return nil, nil, err
+			}
+			value, supplied = answer, true
+		}
+
+		switch {
+		case supplied:
+			converted, err := param.convert(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid value for parameter %s of migration %s: %w", param.Name, m.Name, err)
+			}
+			params[param.Name] = converted
+		case !param.Required():
+			// The default was validated when the metadata was parsed
+			params[param.Name], _ = param.convert(param.Default)
+		default:
+			missing = append(missing, MissingParam{Param: param, Migration: m.Name})
+		}
+	}
+	return params, missing, nil
+}
+
+// promptParam prompts for the parameter until a valid value is given. The answer is added to the supplied values, so
+// that each parameter is only prompted for once.
+func (mg *Migrator) promptParam(param MigrationParam) (string, error) {
+	for {
+		answer, err := mg.Prompt(param)
+		if err != nil {
+			return "", fmt.Errorf("error reading value of parameter %s: %w", param.Name, err)
+		}
+		if answer == "" {
+			continue
+		}
+		if _, err = param.convert(answer); err != nil {
+			mg.Log.Warning("Invalid value for parameter %s: %v", param.Name, err)
+			continue
+		}
+
+		if mg.Params == nil {
+			mg.Params = make(map[string]interface{})
+		}
+		mg.Params[param.Name] = answer
+		return answer, nil
+	}
+}
+
+// ParseParam parses a NAME=VALUE parameter assignment
+func ParseParam(assignment string) (string, string, error) {
+	name, value, ok := strings.Cut(assignment, "=")
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("invalid parameter '%s', expected NAME=VALUE", assignment)
+	}
+	return name, value, nil
+}
@@ -0,0 +1,157 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestMigrationParam_Convert(t *testing.T) {
+	tests := []struct {
+		name        string
+		paramType   ParamType
+		value       interface{}
+		expected    interface{}
+		expectedErr string
+	}{
+		{name: "string", value: "fast-ssd", expected: "fast-ssd"},
+		{name: "number as string", value: 3, expected: "3"},
+		{name: "integer from string", paramType: IntegerParam, value: " 3 ", expected: 3},
+		{name: "integer", paramType: IntegerParam, value: 3, expected: 3},
+		{name: "invalid integer", paramType: IntegerParam, value: "three", expectedErr: "'three' is not an integer"},
+		{name: "float as integer", paramType: IntegerParam, value: 1.5, expectedErr: "expected a value of type integer, found 1.5"},
+		{name: "number from string", paramType: NumberParam, value: "1.5", expected: 1.5},
+		{name: "integer as number", paramType: NumberParam, value: 2, expected: 2},
+		{name: "boolean from string", paramType: BooleanParam, value: "true", expected: true},
+		{name: "boolean", paramType: BooleanParam, value: false, expected: false},
+		{name: "invalid boolean", paramType: BooleanParam, value: "maybe", expectedErr: "'maybe' is not a boolean"},
+		{name: "map", value: map[string]interface{}{"a": 1}, expectedErr: "expected a value of type string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := MigrationParam{Name: "param", Type: tt.paramType}.convert(tt.value)
+			if tt.expectedErr != "" {
+				require.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestParseMigrationMetadata_Params(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expectedErr string
+	}{
+		{name: "valid", content: "params:\n  - name: storageClass\n    description: The storage class of the data volume\n  - name: replicas\n    type: integer\n    default: 3\n"},
+		{name: "invalid name", content: "params:\n  - name: storage-class\n", expectedErr: "invalid parameter name 'storage-class'"},
+		{name: "unknown type", content: "params:\n  - name: size\n    type: quantity\n", expectedErr: "parameter size has unknown type 'quantity'"},
+		{name: "invalid default", content: "params:\n  - name: replicas\n    type: integer\n    default: many\n", expectedErr: "invalid default for parameter replicas: 'many' is not an integer"},
+		{name: "duplicate", content: "params:\n  - name: replicas\n  - name: replicas\n", expectedErr: "parameter replicas is declared more than once"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseMigrationMetadata(tt.content)
+			if tt.expectedErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.expectedErr)
+			}
+		})
+	}
+}
+
+// newParamsMigrationProvider returns a provider with a template migration that reads the storageClass and replicas
+// parameters, and a migration to version 3 that reads the storageClass parameter again
+func newParamsMigrationProvider() *MemoryMigrationProvider {
+	mp := &MemoryMigrationProvider{}
+	mp.AddMigration(majorVersion(2), TemplateFormat, `# migration-mode: merge
+persistence:
+  storageClass: {{ .Params.storageClass }}
+  replicas: {{ .Params.replicas }}
+`)
+	mp.Migrations[0].Metadata = &MigrationMetadata{Params: []MigrationParam{
+		{Name: "storageClass", Description: "The storage class of the data volume"},
+		{Name: "replicas", Type: IntegerParam, Default: 1},
+	}}
+	mp.AddMigration(majorVersion(3), TemplateFormat, `# migration-mode: merge
+backup:
+  storageClass: {{ .Params.storageClass }}
+  enabled: {{ .Params.backup }}
+`)
+	mp.Migrations[1].Metadata = &MigrationMetadata{Params: []MigrationParam{
+		{Name: "storageClass"},
+		{Name: "backup", Type: BooleanParam, Description: "Whether to back up the data volume"},
+	}}
+	return mp
+}
+
+func TestMigrator_Params(t *testing.T) {
+	values := map[string]interface{}{"image": "nginx"}
+	mg := NewMigrator(newParamsMigrationProvider(), *NewLogger(false))
+	mg.Params = map[string]interface{}{"storageClass": "fast-ssd", "backup": "true"}
+
+	result, err := mg.Migrate(values, majorVersion(1), majorVersion(3))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"image":       "nginx",
+		"persistence": map[string]interface{}{"storageClass": "fast-ssd", "replicas": 1},
+		"backup":      map[string]interface{}{"storageClass": "fast-ssd", "enabled": true},
+	}, NormalizeValues(result.Values))
+}
+
+func TestMigrator_MissingParams(t *testing.T) {
+	values := map[string]interface{}{"image": "nginx"}
+
+	_, err := NewMigrator(newParamsMigrationProvider(), *NewLogger(false)).Migrate(values, majorVersion(1), majorVersion(3))
+
+	var missingErr *MissingParamsError
+	require.ErrorAs(t, err, &missingErr)
+	assert.Equal(t, `missing values for migration parameters, supply them with --param NAME=VALUE or --params-file:
+  storageClass (string, to-v2.0.0): The storage class of the data volume
+  backup (boolean, to-v3.0.0): Whether to back up the data volume`, err.Error())
+}
+
+func TestMigrator_PromptParams(t *testing.T) {
+	values := map[string]interface{}{"image": "nginx"}
+	answers := map[string][]string{"storageClass": {"fast-ssd"}, "backup": {"", "maybe", "false"}}
+	var prompted []string
+
+	mg := NewMigrator(newParamsMigrationProvider(), *NewLogger(false))
+	mg.Prompt = func(param MigrationParam) (string, error) {
+		prompted = append(prompted, param.Name)
+		answer := answers[param.Name][0]
+		answers[param.Name] = answers[param.Name][1:]
+		return answer, nil
+	}
+
+	result, err := mg.Migrate(values, majorVersion(1), majorVersion(3))
+	require.NoError(t, err)
+	// Each parameter is prompted for once, until a valid value is given
+	assert.Equal(t, []string{"storageClass", "backup", "backup", "backup"}, prompted)
+	assert.Equal(t, map[string]interface{}{"storageClass": "fast-ssd", "enabled": false}, NormalizeValues(result.Values)["backup"])
+}
+
+func TestMigrator_ParamsHideValues(t *testing.T) {
+	values := map[string]interface{}{"Params": "value"}
+	mg := NewMigrator(newParamsMigrationProvider(), *NewLogger(false))
+	mg.Params = map[string]interface{}{"storageClass": "fast-ssd"}
+
+	_, err := mg.Migrate(values, majorVersion(1), majorVersion(2))
+	require.ErrorContains(t, err, "the values have a top-level Params key, which is hidden by the migration's parameters")
+}
+
+func TestParseParam(t *testing.T) {
+	name, value, err := ParseParam("storageClass=fast=ssd")
+	require.NoError(t, err)
+	assert.Equal(t, "storageClass", name)
+	assert.Equal(t, "fast=ssd", value)
+
+	_, _, err = ParseParam("storageClass")
+	require.ErrorContains(t, err, "invalid parameter 'storageClass', expected NAME=VALUE")
+}
@@ -0,0 +1,284 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"reflect"
+)
+
+// jsonPatchOperation is a single operation of a JSON Patch document, as defined by RFC 6902.
+type jsonPatchOperation struct {
+	Op    string      `yaml:"op" json:"op"`
+	Path  *string     `yaml:"path" json:"path"`
+	From  *string     `yaml:"from" json:"from"`
+	Value interface{} `yaml:"value" json:"value"`
+}
+
+// applyJSONPatch applies a JSON Patch (RFC 6902) document, written as either JSON or YAML, to the values.
+func applyJSONPatch(valuesData map[string]interface{}, content string) (map[string]interface{}, error) {
+	operations, err := parseJSONPatch(content)
+	if err != nil {
+		return nil, err
+	}
+
+	migratedConfig := normalizeMap(valuesData)
+	if migratedConfig == nil {
+		migratedConfig = make(map[string]interface{})
+	}
+
+	for i, op := range operations {
+		if migratedConfig, err = op.apply(migratedConfig); err != nil {
+			return nil, fmt.Errorf("operation %d (%s): %w", i+1, op.Op, err)
+		}
+	}
+
+	return migratedConfig, nil
+}
+
+func parseJSONPatch(content string) ([]jsonPatchOperation, error) {
+	var operations []jsonPatchOperation
+	if err := unmarshalPatch(content, &operations); err != nil {
+		return nil, fmt.Errorf("error parsing JSON patch: %w", err)
+	}
+
+	for i, op := range operations {
+		if err := op.validate(); err != nil {
+			return nil, fmt.Errorf("operation %d (%s): %w", i+1, op.Op, err)
+		}
+	}
+
+	return operations, nil
+}
+
+// applyMergePatch applies a JSON Merge Patch (RFC 7396) document, written as either JSON or YAML, to the values.
+func applyMergePatch(valuesData map[string]interface{}, content string) (map[string]interface{}, error) {
+	patch, err := parseMergePatch(content)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeValues(valuesData, patch), nil
+}
+
+func parseMergePatch(content string) (map[string]interface{}, error) {
+	var patch interface{}
+	if err := unmarshalPatch(content, &patch); err != nil {
+		return nil, fmt.Errorf("error parsing JSON merge patch: %w", err)
+	}
+
+	patchMap, ok := normalizeValue(patch).(map[string]interface{})
+	if patch != nil && !ok {
+		return nil, fmt.Errorf("JSON merge patch must be a map, got %s", describeValue(patch))
+	}
+
+	return patchMap, nil
+}
+
+// unmarshalPatch decodes a patch document written as JSON or YAML. JSON is decoded separately, as JSON indented with
+// tabs is not valid YAML.
+func unmarshalPatch(content string, out interface{}) error {
+	if json.Valid([]byte(content)) {
+		return json.Unmarshal([]byte(content), out)
+	}
+	return yaml.UnmarshalStrict([]byte(content), out)
+}
+
+// validate checks that the operation is well-formed, before it is applied to any values
+func (o jsonPatchOperation) validate() error {
+	switch o.Op {
+	case "add", "remove", "replace", "move", "copy", "test":
+	default:
+		return fmt.Errorf("unknown operation '%s'", o.Op)
+	}
+
+	if o.Path == nil {
+		return fmt.Errorf("missing path")
+	}
+	if *o.Path != "" {
+		if _, err := parseJSONPointer(*o.Path); err != nil {
+			return err
+		}
+	}
+
+	if o.Op == "move" || o.Op == "copy" {
+		if o.From == nil {
+			return fmt.Errorf("missing from")
+		}
+		if _, err := parseJSONPointer(*o.From); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o jsonPatchOperation) apply(values map[string]interface{}) (map[string]interface{}, error) {
+	if o.Path == nil {
+		return nil, fmt.Errorf("missing path")
+	}
+
+	value := normalizeValue(o.Value)
+
+	if *o.Path == "" {
+		// The empty pointer refers to the whole document
+		return o.applyToRoot(values, value)
+	}
+
+	path, err := parseJSONPointer(*o.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o.Op {
+	case "add":
+		return values, path.insert(values, value)
+
+	case "remove":
+		removed, err := path.remove(values)
+		if err == nil && !removed {
+			err = fmt.Errorf("'%s' does not exist", *o.Path)
+		}
+		return values, err
+
+	case "replace":
+		if err := o.mustExist(values, path, *o.Path); err != nil {
+			return nil, err
+		}
+		return values, path.set(values, value)
+
+	case "move", "copy":
+		if o.From == nil {
+			return nil, fmt.Errorf("missing from")
+		}
+		from, err := parseJSONPointer(*o.From)
+		if err != nil {
+			return nil, err
+		}
+		existing, found, err := from.lookup(values)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("'%s' does not exist", *o.From)
+		}
+		if o.Op == "move" {
+			if from.isPrefixOf(path) && len(from) != len(path) {
+				return nil, fmt.Errorf("cannot move '%s' into itself at '%s'", *o.From, *o.Path)
+			}
+			if _, err := from.remove(values); err != nil {
+				return nil, err
+			}
+		}
+		return values, path.insert(values, normalizeValue(existing))
+
+	case "test":
+		existing, found, err := path.lookup(values)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("test failed: '%s' does not exist, expected %s", *o.Path, displayValue(value))
+		}
+		if !valuesEqual(existing, value) {
+			return nil, fmt.Errorf("test failed: '%s' is %s, expected %s", *o.Path, displayValue(existing), displayValue(value))
+		}
+		return values, nil
+	}
+
+	return nil, fmt.Errorf("unknown operation '%s'", o.Op)
+}
+
+func (o jsonPatchOperation) applyToRoot(values map[string]interface{}, value interface{}) (map[string]interface{}, error) {
+	switch o.Op {
+	case "test":
+		if !valuesEqual(values, value) {
+			return nil, fmt.Errorf("test failed: the values are %s, expected %s", displayValue(values), displayValue(value))
+		}
+		return values, nil
+	case "add", "replace":
+		replaced, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("the values must be a map, got %s", describeValue(value))
+		}
+		return replaced, nil
+	default:
+		return nil, fmt.Errorf("operation '%s' is not supported on the whole document", o.Op)
+	}
+}
+
+func (o jsonPatchOperation) mustExist(values map[string]interface{}, path valuePath, pointer string) error {
+	_, found, err := path.lookup(values)
+	if err == nil && !found {
+		err = fmt.Errorf("'%s' does not exist", pointer)
+	}
+	return err
+}
+
+func parseJSONPointer(pointer string) (valuePath, error) {
+	if len(pointer) == 0 || pointer[0] != '/' {
+		return nil, fmt.Errorf("'%s' is not a valid JSON pointer", pointer)
+	}
+	return parseValuePath(pointer)
+}
+
+// valuesEqual compares two values regardless of the map types used by the YAML and JSON decoders, treating numbers of
+// different Go types as equal when they have the same value.
+func valuesEqual(a, b interface{}) bool {
+	a, b = normalizeValue(a), normalizeValue(b)
+
+	if an, ok := asFloat(a); ok {
+		bn, ok := asFloat(b)
+		return ok && an == bn
+	}
+
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for key, item := range av {
+			other, ok := bv[key]
+			if !ok || !valuesEqual(item, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !valuesEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
+
+func asFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+func displayValue(value interface{}) string {
+	data, err := json.Marshal(normalizeValue(value))
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
@@ -0,0 +1,241 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+var jsonPatchTestCases = []struct {
+	name     string
+	current  map[string]interface{}
+	patch    string
+	expected map[string]interface{}
+}{
+	{
+		name: "add, remove and replace in YAML",
+		current: map[string]interface{}{
+			"legacy":   true,
+			"replicas": 1,
+			"agent":    map[interface{}]interface{}{"name": "my-agent"},
+		},
+		patch: `
+- op: remove
+  path: /legacy
+- op: replace
+  path: /replicas
+  value: 3
+- op: add
+  path: /agent/labels
+  value:
+    team: octopus
+`,
+		expected: map[string]interface{}{
+			"replicas": 3,
+			"agent": map[string]interface{}{
+				"name":   "my-agent",
+				"labels": map[string]interface{}{"team": "octopus"},
+			},
+		},
+	},
+	{
+		name: "move and copy in JSON",
+		current: map[string]interface{}{
+			"agent": map[string]interface{}{
+				"targetEnvironments": []interface{}{"test"},
+				"name":               "my-agent",
+			},
+		},
+		patch: `[
+	{"op": "add", "path": "/agent/target", "value": {}},
+	{"op": "move", "from": "/agent/targetEnvironments", "path": "/agent/target/environments"},
+	{"op": "copy", "from": "/agent/name", "path": "/agent/target/name"}
+]`,
+		expected: map[string]interface{}{
+			"agent": map[string]interface{}{
+				"name": "my-agent",
+				"target": map[string]interface{}{
+					"environments": []interface{}{"test"},
+					"name":         "my-agent",
+				},
+			},
+		},
+	},
+	{
+		name: "add inserts into lists",
+		current: map[string]interface{}{
+			"environments": []interface{}{"a", "c"},
+		},
+		patch: `
+- op: add
+  path: /environments/1
+  value: b
+- op: add
+  path: /environments/-
+  value: d
+- op: remove
+  path: /environments/0
+`,
+		expected: map[string]interface{}{
+			"environments": []interface{}{"b", "c", "d"},
+		},
+	},
+	{
+		name: "passing tests continue the migration",
+		current: map[string]interface{}{
+			"replicas": float64(3),
+			"agent":    map[string]interface{}{"environments": []interface{}{"test"}},
+		},
+		patch: `
+- op: test
+  path: /replicas
+  value: 3
+- op: test
+  path: /agent
+  value:
+    environments: [test]
+- op: replace
+  path: /replicas
+  value: 4
+`,
+		expected: map[string]interface{}{
+			"replicas": 4,
+			"agent":    map[string]interface{}{"environments": []interface{}{"test"}},
+		},
+	},
+}
+
+func TestJSONPatch_Apply(t *testing.T) {
+	for _, tc := range jsonPatchTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := assert.New(t)
+			req := require.New(t)
+
+			migrated, err := applyJSONPatch(tc.current, tc.patch)
+			req.NoError(err)
+
+			is.EqualValues(tc.expected, migrated)
+		})
+	}
+}
+
+var jsonPatchErrorTestCases = []struct {
+	name        string
+	patch       string
+	expectedErr string
+}{
+	{
+		name: "failed test",
+		patch: `
+- op: test
+  path: /agent/name
+  value: other-agent
+`,
+		expectedErr: `operation 1 (test): test failed: '/agent/name' is "my-agent", expected "other-agent"`,
+	},
+	{
+		name: "test of missing value",
+		patch: `
+- op: test
+  path: /agent/version
+  value: 2
+`,
+		expectedErr: `operation 1 (test): test failed: '/agent/version' does not exist, expected 2`,
+	},
+	{
+		name: "remove missing value",
+		patch: `
+- op: remove
+  path: /agent/version
+`,
+		expectedErr: `operation 1 (remove): '/agent/version' does not exist`,
+	},
+	{
+		name: "add with missing parent",
+		patch: `
+- op: add
+  path: /service/port
+  value: 80
+`,
+		expectedErr: `operation 1 (add): the parent of 'service.port' does not exist`,
+	},
+	{
+		name: "path is not a pointer",
+		patch: `
+- op: remove
+  path: agent.name
+`,
+		expectedErr: `operation 1 (remove): 'agent.name' is not a valid JSON pointer`,
+	},
+}
+
+func TestJSONPatch_Errors(t *testing.T) {
+	current := map[string]interface{}{
+		"agent": map[string]interface{}{"name": "my-agent"},
+	}
+
+	for _, tc := range jsonPatchErrorTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := applyJSONPatch(current, tc.patch)
+			require.EqualError(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestMergePatch_Apply(t *testing.T) {
+	current := map[string]interface{}{
+		"myKey": "myValue",
+		"agent": map[interface{}]interface{}{
+			"targetEnvironment": "test",
+			"name":              "my-agent",
+		},
+	}
+
+	migrated, err := applyMergePatch(current, `{"agent": {"targetEnvironment": null, "targetEnvironments": ["test"]}}`)
+	require.NoError(t, err)
+
+	assert.EqualValues(t, map[string]interface{}{
+		"myKey": "myValue",
+		"agent": map[string]interface{}{
+			"targetEnvironments": []interface{}{"test"},
+			"name":               "my-agent",
+		},
+	}, migrated)
+}
+
+func TestMigrator_PatchMigrationFiles(t *testing.T) {
+	is := assert.New(t)
+	req := require.New(t)
+
+	dir := t.TempDir()
+	writeMigrationFile(t, dir, "to-v2.merge.yaml", `
+agent:
+  targetEnvironment: null
+  targetEnvironments: [test]
+`)
+	writeMigrationFile(t, dir, "to-v3.patch.json", `[
+	{"op": "test", "path": "/agent/targetEnvironments/0", "value": "test"},
+	{"op": "move", "from": "/agent/targetEnvironments", "path": "/agent/environments"}
+]`)
+	writeMigrationFile(t, dir, "to-v4.patch.yaml", `
+- op: test
+  path: /agent/environments
+  value: [production]
+`)
+	writeMigrationFile(t, dir, "to-v5.json", `{}`)
+
+	mp, err := NewFileSystemMigrationProvider(dir)
+	req.NoError(err)
+	is.Len(mp.Migrations, 3)
+
+	migrated, err := Migrate(version1Config, majorVersion(1), majorVersion(3), mp, *NewLogger(false))
+	req.NoError(err)
+	is.EqualValues(map[string]interface{}{
+		"agent": map[string]interface{}{
+			"environments": []interface{}{"test"},
+		},
+	}, migrated)
+
+	_, err = Migrate(version1Config, majorVersion(1), nil, mp, *NewLogger(false))
+	req.EqualError(err, `error applying migration to-v4.patch.yaml: operation 1 (test): test failed: '/agent/environments' is ["test"], expected ["production"]`)
+}
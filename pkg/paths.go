@@ -0,0 +1,267 @@
+package pkg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// valuePath addresses a value within a values map, one segment per map key or list index.
+type valuePath []string
+
+// parseValuePath parses either a JSON pointer (e.g. "/agent/target/environments") or a dotted path
+// (e.g. "agent.target.environments"). Dots that are part of a key in a dotted path can be escaped as "\.".
+func parseValuePath(path string) (valuePath, error) {
+	if path == "" {
+		return nil, fmt.Errorf("path must not be empty")
+	}
+
+	if strings.HasPrefix(path, "/") {
+		segments := strings.Split(path[1:], "/")
+		for i, segment := range segments {
+			segments[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(segment)
+		}
+		return segments, nil
+	}
+
+	var segments []string
+	var current strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '\\' && i+1 < len(path) && path[i+1] == '.':
+			current.WriteByte('.')
+			i++
+		case path[i] == '.':
+			segments = append(segments, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(path[i])
+		}
+	}
+	segments = append(segments, current.String())
+
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("path '%s' contains an empty key", path)
+		}
+	}
+
+	return segments, nil
+}
+
+func (p valuePath) String() string {
+	escaped := make([]string, len(p))
+	for i, segment := range p {
+		escaped[i] = strings.ReplaceAll(segment, ".", `\.`)
+	}
+	return strings.Join(escaped, ".")
+}
+
+func (p valuePath) parent() valuePath {
+	return p[:len(p)-1]
+}
+
+func (p valuePath) last() string {
+	return p[len(p)-1]
+}
+
+// isPrefixOf reports whether other is the same path as p, or is nested within it.
+func (p valuePath) isPrefixOf(other valuePath) bool {
+	if len(p) > len(other) {
+		return false
+	}
+	for i := range p {
+		if p[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup returns the value at the path. Missing keys, null parents and out-of-range list indexes are reported as not
+// found, while traversing through a scalar value is an error.
+func (p valuePath) lookup(root map[string]interface{}) (interface{}, bool, error) {
+	var node interface{} = root
+	for i, key := range p {
+		switch n := node.(type) {
+		case nil:
+			return nil, false, nil
+		case map[string]interface{}:
+			child, ok := n[key]
+			if !ok {
+				return nil, false, nil
+			}
+			node = child
+		case []interface{}:
+			idx, err := listIndex(p[:i+1])
+			if err != nil {
+				return nil, false, err
+			}
+			if idx >= len(n) {
+				return nil, false, nil
+			}
+			node = n[idx]
+		default:
+			return nil, false, p[:i].typeError(node, "a map or list")
+		}
+	}
+	return node, true, nil
+}
+
+// container returns the map or list at the path. When create is set, missing and null maps along the way are created,
+// otherwise nil is returned if any part of the path is missing.
+func (p valuePath) container(root map[string]interface{}, create bool) (interface{}, error) {
+	var node interface{} = root
+	for i, key := range p {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[key]
+			if !ok || child == nil {
+				if !create {
+					return nil, nil
+				}
+				child = make(map[string]interface{})
+				n[key] = child
+			}
+			node = child
+		case []interface{}:
+			idx, err := listIndex(p[:i+1])
+			if err != nil {
+				return nil, err
+			}
+			if idx >= len(n) {
+				if !create {
+					return nil, nil
+				}
+				return nil, fmt.Errorf("index %d is out of range at '%s'", idx, p[:i+1])
+			}
+			node = n[idx]
+		default:
+			return nil, p[:i].typeError(node, "a map or list")
+		}
+	}
+
+	switch node.(type) {
+	case map[string]interface{}, []interface{}:
+		return node, nil
+	default:
+		return nil, p.typeError(node, "a map or list")
+	}
+}
+
+// set stores the value at the path, creating any missing parent maps. A list index of "-" appends to the list.
+func (p valuePath) set(root map[string]interface{}, value interface{}) error {
+	parent, err := p.parent().container(root, true)
+	if err != nil {
+		return err
+	}
+
+	switch c := parent.(type) {
+	case map[string]interface{}:
+		c[p.last()] = value
+	case []interface{}:
+		if p.last() == "-" {
+			return p.parent().set(root, append(c, value))
+		}
+		idx, err := listIndex(p)
+		if err != nil {
+			return err
+		}
+		if idx >= len(c) {
+			return fmt.Errorf("index %d is out of range at '%s'", idx, p)
+		}
+		c[idx] = value
+	}
+	return nil
+}
+
+// insert adds the value at the path without creating missing parents. Unlike set, a list index inserts the value
+// before the existing item at that index rather than replacing it.
+func (p valuePath) insert(root map[string]interface{}, value interface{}) error {
+	parent, err := p.parent().container(root, false)
+	if err != nil {
+		return err
+	}
+	if parent == nil {
+		return fmt.Errorf("the parent of '%s' does not exist", p)
+	}
+
+	switch c := parent.(type) {
+	case map[string]interface{}:
+		c[p.last()] = value
+	case []interface{}:
+		idx := len(c)
+		if p.last() != "-" {
+			if idx, err = listIndex(p); err != nil {
+				return err
+			}
+			if idx > len(c) {
+				return fmt.Errorf("index %d is out of range at '%s'", idx, p)
+			}
+		}
+		inserted := append(append(c[:idx:idx], value), c[idx:]...)
+		return p.parent().set(root, inserted)
+	}
+	return nil
+}
+
+// remove deletes the value at the path, reporting whether there was anything to delete.
+func (p valuePath) remove(root map[string]interface{}) (bool, error) {
+	parent, err := p.parent().container(root, false)
+	if err != nil || parent == nil {
+		return false, err
+	}
+
+	switch c := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := c[p.last()]; !ok {
+			return false, nil
+		}
+		delete(c, p.last())
+	case []interface{}:
+		idx, err := listIndex(p)
+		if err != nil {
+			return false, err
+		}
+		if idx >= len(c) {
+			return false, nil
+		}
+		remaining := append(c[:idx:idx], c[idx+1:]...)
+		return true, p.parent().set(root, remaining)
+	}
+	return true, nil
+}
+
+func listIndex(p valuePath) (int, error) {
+	idx, err := strconv.Atoi(p.last())
+	if err != nil || idx < 0 {
+		return 0, fmt.Errorf("'%s' is not a valid list index at '%s'", p.last(), p)
+	}
+	return idx, nil
+}
+
+func (p valuePath) typeError(value interface{}, expected string) error {
+	if len(p) == 0 {
+		return fmt.Errorf("the values are %s, expected %s", describeValue(value), expected)
+	}
+	return fmt.Errorf("'%s' is %s, expected %s", p, describeValue(value), expected)
+}
+
+func describeValue(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}, map[interface{}]interface{}:
+		return "a map"
+	case []interface{}:
+		return "a list"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case int, int64, uint64, float64:
+		return "a number"
+	default:
+		return fmt.Sprintf("a %T", value)
+	}
+}
@@ -0,0 +1,100 @@
+package pkg
+
+import (
+	"fmt"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// RenderError is returned when the chart cannot be rendered with the migrated values. It points back to the migration
+// steps that last changed the values referenced by the error.
+type RenderError struct {
+	Err error
+	// Sources maps each values path referenced by the error to the migration that last changed it
+	Sources map[string]string
+	// Steps lists the migrations that were applied, for errors that do not reference a values path
+	Steps []MigrationStep
+}
+
+func (e *RenderError) Error() string {
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "error rendering chart with the migrated values: %s", e.Err)
+
+	if len(e.Sources) > 0 {
+		for _, p := range slices.Sorted(maps.Keys(e.Sources)) {
+			_, _ = fmt.Fprintf(&sb, "\n  .Values.%s was last changed by migration %s", p, e.Sources[p])
+		}
+	} else if len(e.Steps) > 0 {
+		sb.WriteString("\nThe values were changed by the following migrations:")
+		for _, step := range e.Steps {
+			_, _ = fmt.Fprintf(&sb, "\n  %s: %s", step.Migration.Name, strings.Join(step.Changes.Paths(), ", "))
+		}
+	}
+
+	return sb.String()
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+// VerifyRender renders the chart with the migrated values using Helm's template engine, in the same way as
+// helm template, to catch errors such as `required` and `fail` calls that a values schema cannot. If caps is nil,
+// chartutil.DefaultCapabilities are used. When rendering fails, a *RenderError is returned.
+func VerifyRender(chrt *chart.Chart, result *MigrationResult, releaseName, namespace string, caps *chartutil.Capabilities, log Logger) error {
+	if caps == nil {
+		caps = chartutil.DefaultCapabilities
+	}
+
+	cfg := &action.Configuration{
+		Releases: storage.Init(driver.NewMemory()),
+		Log:      log.Debug,
+	}
+
+	install := action.NewInstall(cfg)
+	install.DryRun = true
+	install.ClientOnly = true
+	install.Replace = true
+	install.IsUpgrade = true
+	install.ReleaseName = releaseName
+	install.Namespace = namespace
+	install.KubeVersion = &caps.KubeVersion
+	install.APIVersions = caps.APIVersions
+
+	log.Debug("Rendering chart %s with the migrated values", chrt.Name())
+	if _, err := install.Run(chrt, NormalizeValues(result.Values)); err != nil {
+		return newRenderError(err, result.Steps)
+	}
+
+	return nil
+}
+
+var valuesReferenceRegEx = regexp.MustCompile(`\.Values((?:\.[A-Za-z0-9_-]+)+)`)
+
+func newRenderError(err error, steps []MigrationStep) *RenderError {
+	renderErr := &RenderError{Err: err, Sources: make(map[string]string), Steps: steps}
+
+	for _, match := range valuesReferenceRegEx.FindAllStringSubmatch(err.Error(), -1) {
+		referenced := strings.TrimPrefix(match[1], ".")
+		for i := len(steps) - 1; i >= 0; i-- {
+			if slices.ContainsFunc(steps[i].Changes.Paths(), func(changed string) bool { return pathsOverlap(referenced, changed) }) {
+				renderErr.Sources[referenced] = steps[i].Migration.Name
+				break
+			}
+		}
+	}
+
+	return renderErr
+}
+
+// pathsOverlap reports whether one dotted path is the same as, or nested within, the other
+func pathsOverlap(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+".") || strings.HasPrefix(b, a+".")
+}
@@ -0,0 +1,88 @@
+package pkg
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const renderTestTemplate = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}
+data:
+  environments: {{ join "," .Values.agent.target.environments | quote }}
+  name: {{ required "agent.name is required" .Values.agent.name | quote }}
+`
+
+func renderTestMigrations() MigrationProvider {
+	mp := &MemoryMigrationProvider{}
+	mp.AddMigration(majorVersion(2), OperationsFormat, `
+- op: move
+  from: agent.targetEnvironment
+  path: agent.target.environments
+- op: toList
+  path: agent.target.environments
+`)
+	mp.AddMigration(majorVersion(3), OperationsFormat, `
+- op: renameKey
+  path: agent.name
+  to: displayName
+`)
+	return mp
+}
+
+func TestRender_VerifyRender(t *testing.T) {
+	current := map[string]interface{}{
+		"agent": map[string]interface{}{"targetEnvironment": "test", "displayName": "my-agent"},
+	}
+	mp := &MemoryMigrationProvider{}
+	mp.AddMigration(majorVersion(2), OperationsFormat, `
+- op: move
+  from: agent.targetEnvironment
+  path: agent.target.environments
+- op: toList
+  path: agent.target.environments
+- op: renameKey
+  path: agent.displayName
+  to: name
+`)
+
+	result, err := NewMigrator(mp, *NewLogger(false)).Migrate(current, majorVersion(1), majorVersion(3))
+	require.NoError(t, err)
+
+	assert.NoError(t, VerifyRender(testChart("my-chart", "3.0.0", map[string]string{"templates/configmap.yaml": renderTestTemplate}), result, "my-release", "default", nil, *NewLogger(false)))
+}
+
+func TestRender_PointsToMigrationStep(t *testing.T) {
+	current := map[string]interface{}{
+		"agent": map[string]interface{}{"targetEnvironment": "test", "name": "my-agent"},
+	}
+
+	result, err := NewMigrator(renderTestMigrations(), *NewLogger(false)).Migrate(current, majorVersion(1), majorVersion(3))
+	require.NoError(t, err)
+	require.Len(t, result.Steps, 2)
+
+	err = VerifyRender(testChart("my-chart", "3.0.0", map[string]string{"templates/configmap.yaml": renderTestTemplate}), result, "my-release", "default", nil, *NewLogger(false))
+
+	var renderErr *RenderError
+	require.ErrorAs(t, err, &renderErr)
+	assert.ErrorContains(t, err, "agent.name is required")
+	// The error from `required` does not reference the values path, so every step is listed
+	assert.ErrorContains(t, err, "to-v2.0.0: agent.target.environments, agent.targetEnvironment")
+	assert.ErrorContains(t, err, "to-v3.0.0: agent.displayName, agent.name")
+}
+
+func TestRender_ReferencedValuesPath(t *testing.T) {
+	steps := []MigrationStep{
+		{Migration: &Migration{Name: "to-v2.yaml"}, Changes: ValuesDiff{Moved: []ValueMove{{From: "agent.targetEnvironment", To: "agent.target.environments"}}}},
+		{Migration: &Migration{Name: "to-v3.yaml"}, Changes: ValuesDiff{Removed: []ValueChange{{Path: "agent.target"}}}},
+		{Migration: &Migration{Name: "to-v4.yaml"}, Changes: ValuesDiff{Added: []ValueChange{{Path: "service.port"}}}},
+	}
+
+	renderErr := newRenderError(errors.New(`template: my-chart/templates/configmap.yaml:6:30: executing "my-chart/templates/configmap.yaml" at <.Values.agent.target.environments>: invalid value; expected string`), steps)
+
+	assert.Equal(t, map[string]string{"agent.target.environments": "to-v3.yaml"}, renderErr.Sources)
+	assert.Contains(t, renderErr.Error(), ".Values.agent.target.environments was last changed by migration to-v3.yaml")
+}
@@ -0,0 +1,420 @@
+package pkg
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Scaffold is a first draft of a migration between two versions of a chart, derived from their default values. It is a
+// starting point for a chart author to review, as the defaults alone cannot show every change to the values.
+type Scaffold struct {
+	// Moves are the removed values that were matched to an added value
+	Moves []ScaffoldMove
+	// Removed are the removed values that could not be matched
+	Removed []ValueChange
+	// Added are the added values that could not be matched
+	Added []ValueChange
+}
+
+type ScaffoldMove struct {
+	From string
+	To   string
+	// Reason describes why the values were matched
+	Reason string
+}
+
+// ScaffoldMigration compares the default values of two versions of a chart, matching each removed value with the added
+// value it most likely moved to. Values are matched when they have the same default value, or when their keys have the
+// same or similar names. Where every value in a map moved, the map is moved as a whole.
+func ScaffoldMigration(oldDefaults, newDefaults map[string]interface{}) Scaffold {
+	oldLeaves := flattenValues(normalizeMap(oldDefaults))
+	newLeaves := flattenValues(normalizeMap(newDefaults))
+
+	var removed, added []ValueChange
+	for _, p := range sortedKeys(oldLeaves) {
+		if _, ok := newLeaves[p]; !ok {
+			removed = append(removed, ValueChange{Path: p, OldValue: oldLeaves[p]})
+		}
+	}
+	for _, p := range sortedKeys(newLeaves) {
+		if _, ok := oldLeaves[p]; !ok {
+			added = append(added, ValueChange{Path: p, NewValue: newLeaves[p]})
+		}
+	}
+
+	type candidate struct {
+		removed, added int
+		score, suffix  int
+		reason         string
+	}
+	var candidates []candidate
+	for i, r := range removed {
+		for j, a := range added {
+			if score, reason := scaffoldMatchScore(r, a); score >= 2 {
+				candidates = append(candidates, candidate{removed: i, added: j, score: score, suffix: commonSuffixLength(r.Path, a.Path), reason: reason})
+			}
+		}
+	}
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		return cmp.Or(cmp.Compare(b.score, a.score), cmp.Compare(b.suffix, a.suffix))
+	})
+
+	var scaffold Scaffold
+	matchedRemoved, matchedAdded := make(map[int]bool), make(map[int]bool)
+	for _, c := range candidates {
+		if matchedRemoved[c.removed] || matchedAdded[c.added] {
+			continue
+		}
+		matchedRemoved[c.removed], matchedAdded[c.added] = true, true
+		scaffold.Moves = append(scaffold.Moves, ScaffoldMove{From: removed[c.removed].Path, To: added[c.added].Path, Reason: c.reason})
+	}
+
+	for i, r := range removed {
+		if !matchedRemoved[i] {
+			scaffold.Removed = append(scaffold.Removed, r)
+		}
+	}
+	for i, a := range added {
+		if !matchedAdded[i] {
+			scaffold.Added = append(scaffold.Added, a)
+		}
+	}
+
+	scaffold.Moves = collapseMoves(scaffold.Moves, oldLeaves, newLeaves)
+	slices.SortFunc(scaffold.Moves, func(a, b ScaffoldMove) int { return strings.Compare(a.From, b.From) })
+	scaffold.Removed = collapseChanges(scaffold.Removed, oldLeaves, newLeaves)
+	scaffold.Added = collapseChanges(scaffold.Added, newLeaves, oldLeaves)
+
+	return scaffold
+}
+
+// scaffoldMatchScore scores how likely it is that a removed value moved to an added value. A score of 2 or more is
+// considered a match, which requires more than an equal empty or zero value, or a similar key name in another map,
+// alone.
+func scaffoldMatchScore(removed, added ValueChange) (int, string) {
+	removedPath, errR := parseValuePath(removed.Path)
+	addedPath, errA := parseValuePath(added.Path)
+	if errR != nil || errA != nil {
+		return 0, ""
+	}
+
+	score := 0
+	var reasons []string
+	if valuesEqual(removed.OldValue, added.NewValue) {
+		if isZeroValue(removed.OldValue) {
+			score += 1
+		} else {
+			score += 3
+		}
+		reasons = append(reasons, "same default value")
+	}
+
+	switch {
+	case removedPath.last() == addedPath.last():
+		score += 2
+		reasons = append(reasons, "same key name")
+	case similarKeys(removedPath.last(), addedPath.last()):
+		score += 1
+		reasons = append(reasons, "similar key name")
+		if slices.Equal(removedPath.parent(), addedPath.parent()) {
+			score += 1
+			reasons[len(reasons)-1] = "similar key name in the same map"
+		}
+	}
+
+	return score, strings.Join(reasons, " and ")
+}
+
+func isZeroValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case bool:
+		return !v
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	f, ok := asFloat(value)
+	return ok && f == 0
+}
+
+// similarKeys reports whether the keys are the same regardless of case and separators, or one contains the other,
+// e.g. targetEnvironment and targetEnvironments, or image_tag and imageTag.
+func similarKeys(a, b string) bool {
+	normalize := func(key string) string {
+		return strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(key))
+	}
+	a, b = normalize(a), normalize(b)
+	if len(a) < 3 || len(b) < 3 {
+		return a == b
+	}
+	return strings.Contains(a, b) || strings.Contains(b, a)
+}
+
+// collapseMoves replaces the moves of every value in a map with a move of the map itself, where the map was moved as a
+// whole to a path that did not exist before.
+func collapseMoves(moves []ScaffoldMove, oldLeaves, newLeaves map[string]interface{}) []ScaffoldMove {
+	movedTo := make(map[string]string, len(moves))
+	for _, m := range moves {
+		movedTo[m.From] = m.To
+	}
+
+	var collapsed []ScaffoldMove
+	for _, m := range moves {
+		from, errF := parseValuePath(m.From)
+		to, errT := parseValuePath(m.To)
+		if errF != nil || errT != nil {
+			collapsed = append(collapsed, m)
+			continue
+		}
+
+		// Try the shortest parent first, so that the largest possible map is moved
+		result := m
+		for suffix := min(len(from), len(to)) - 1; suffix > 0; suffix-- {
+			if !slices.Equal(from[len(from)-suffix:], to[len(to)-suffix:]) {
+				continue
+			}
+			fromParent, toParent := from[:len(from)-suffix], to[:len(to)-suffix]
+			if isMovedAsWhole(fromParent, toParent, movedTo, oldLeaves, newLeaves) {
+				result = ScaffoldMove{From: fromParent.String(), To: toParent.String(), Reason: "every value in the map moved"}
+				break
+			}
+		}
+
+		if !slices.ContainsFunc(collapsed, func(c ScaffoldMove) bool { return c.From == result.From }) {
+			collapsed = append(collapsed, result)
+		}
+	}
+	return collapsed
+}
+
+func isMovedAsWhole(fromParent, toParent valuePath, movedTo map[string]string, oldLeaves, newLeaves map[string]interface{}) bool {
+	if fromParent.isPrefixOf(toParent) || toParent.isPrefixOf(fromParent) {
+		return false
+	}
+
+	for p := range oldLeaves {
+		leaf, err := parseValuePath(p)
+		if err != nil {
+			return false
+		}
+		if fromParent.isPrefixOf(leaf) {
+			expected := append(slices.Clone(toParent), leaf[len(fromParent):]...)
+			if movedTo[p] != expected.String() {
+				return false
+			}
+		} else if toParent.isPrefixOf(leaf) || leaf.isPrefixOf(toParent) {
+			return false
+		}
+	}
+
+	for p := range newLeaves {
+		if leaf, err := parseValuePath(p); err != nil || fromParent.isPrefixOf(leaf) {
+			return false
+		}
+	}
+	return true
+}
+
+// collapseChanges replaces the changes of every value in a map with a change of the map itself, where none of the map's
+// values exist in the other version.
+func collapseChanges(changes []ValueChange, leaves, otherLeaves map[string]interface{}) []ValueChange {
+	changed := make(map[string]bool, len(changes))
+	for _, c := range changes {
+		changed[c.Path] = true
+	}
+
+	onlyChanged := func(parent valuePath) bool {
+		for p := range leaves {
+			if leaf, err := parseValuePath(p); err != nil || (parent.isPrefixOf(leaf) && !changed[p]) {
+				return false
+			}
+		}
+		for p := range otherLeaves {
+			if leaf, err := parseValuePath(p); err != nil || parent.isPrefixOf(leaf) || leaf.isPrefixOf(parent) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var collapsed []ValueChange
+	for _, c := range changes {
+		path, err := parseValuePath(c.Path)
+		if err != nil {
+			collapsed = append(collapsed, c)
+			continue
+		}
+
+		result := c
+		for n := 1; n < len(path); n++ {
+			if onlyChanged(path[:n]) {
+				result = ValueChange{Path: path[:n].String()}
+				break
+			}
+		}
+
+		if !slices.ContainsFunc(collapsed, func(existing ValueChange) bool { return existing.Path == result.Path }) {
+			collapsed = append(collapsed, result)
+		}
+	}
+	return collapsed
+}
+
+// Operations formats the scaffold as a declarative operations migration (to-vN.ops.yaml)
+func (s Scaffold) Operations(header string) string {
+	var sb strings.Builder
+	writeCommentLines(&sb, header)
+
+	for _, m := range s.Moves {
+		from, errF := parseValuePath(m.From)
+		to, errT := parseValuePath(m.To)
+		if errF == nil && errT == nil && from.isPrefixOf(to) {
+			_, _ = fmt.Fprintf(&sb, "# TODO: '%s' moved into '%s' (%s), which a move operation cannot do. Use a template migration instead.\n", m.From, m.To, m.Reason)
+			continue
+		}
+
+		_, _ = fmt.Fprintf(&sb, "# %s -> %s: %s\n", m.From, m.To, m.Reason)
+		_, _ = fmt.Fprintf(&sb, "- op: move\n  from: %s\n  path: %s\n", quoteScaffoldString(m.From), quoteScaffoldString(m.To))
+	}
+
+	for _, r := range s.Removed {
+		_, _ = fmt.Fprintf(&sb, "# TODO: '%s' was removed and no replacement was found. Migrate it, or remove it if it is no longer used:\n", r.Path)
+		_, _ = fmt.Fprintf(&sb, "# - op: delete\n#   path: %s\n", quoteScaffoldString(r.Path))
+	}
+
+	s.writeAddedTodos(&sb)
+	return sb.String()
+}
+
+// Template formats the scaffold as a merge mode template migration (to-vN.yaml)
+func (s Scaffold) Template(header string) string {
+	var sb strings.Builder
+	writeCommentLines(&sb, header)
+	sb.WriteString("# migration-mode: merge\n")
+
+	for _, m := range s.Moves {
+		_, _ = fmt.Fprintf(&sb, "# %s -> %s: %s\n", m.From, m.To, m.Reason)
+	}
+	for _, r := range s.Removed {
+		_, _ = fmt.Fprintf(&sb, "# TODO: '%s' was removed and no replacement was found. Migrate it, or set it to null if it is no longer used.\n", r.Path)
+	}
+	s.writeAddedTodos(&sb)
+
+	root := &scaffoldNode{}
+	for _, m := range s.Moves {
+		if from, err := parseValuePath(m.From); err == nil {
+			root.add(from, "null", false)
+		}
+	}
+	for _, m := range s.Moves {
+		from, errF := parseValuePath(m.From)
+		to, errT := parseValuePath(m.To)
+		if errF != nil || errT != nil {
+			continue
+		}
+
+		keys := make([]string, 0, len(from))
+		for _, key := range from {
+			keys = append(keys, strconv.Quote(key))
+		}
+		root.add(to, fmt.Sprintf("{{ dig %s nil . | toJson }}", strings.Join(keys, " ")), true)
+	}
+
+	root.write(&sb, 0)
+	return sb.String()
+}
+
+func (s Scaffold) writeAddedTodos(sb *strings.Builder) {
+	for _, a := range s.Added {
+		if a.NewValue == nil {
+			_, _ = fmt.Fprintf(sb, "# TODO: '%s' was added. Set it if it should be derived from existing values.\n", a.Path)
+		} else {
+			_, _ = fmt.Fprintf(sb, "# TODO: '%s' was added with the default %s. Set it if it should be derived from existing values.\n", a.Path, displayValue(a.NewValue))
+		}
+	}
+}
+
+func writeCommentLines(sb *strings.Builder, text string) {
+	if text == "" {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		sb.WriteString(strings.TrimRight("# "+line, " "))
+		sb.WriteString("\n")
+	}
+}
+
+func quoteScaffoldString(s string) string {
+	if isPlainYamlKey(s) {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+func isPlainYamlKey(s string) bool {
+	if s == "" || s == "null" || s == "true" || s == "false" {
+		return false
+	}
+	for _, r := range s {
+		if !(r == '-' || r == '_' || r == '.' || r == '/' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')) {
+			return false
+		}
+	}
+	return true
+}
+
+// scaffoldNode builds the YAML of a template migration, whose values are template expressions rather than YAML values
+type scaffoldNode struct {
+	children map[string]*scaffoldNode
+	value    string
+}
+
+// add sets the value at the path. Values only replace a map when replace is set, so that a removed value (null) does
+// not remove values moved beneath it.
+func (n *scaffoldNode) add(path valuePath, value string, replace bool) {
+	node := n
+	for _, key := range path {
+		if node.children == nil {
+			node.children = make(map[string]*scaffoldNode)
+			node.value = ""
+		}
+		child, ok := node.children[key]
+		if !ok {
+			child = &scaffoldNode{}
+			node.children[key] = child
+		}
+		node = child
+	}
+
+	if node.children == nil || replace {
+		node.children, node.value = nil, value
+	}
+}
+
+func (n *scaffoldNode) write(sb *strings.Builder, indent int) {
+	keys := make([]string, 0, len(n.children))
+	for key := range n.children {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		child := n.children[key]
+		sb.WriteString(strings.Repeat("  ", indent))
+		sb.WriteString(quoteScaffoldString(key))
+		if child.children == nil {
+			_, _ = fmt.Fprintf(sb, ": %s\n", child.value)
+			continue
+		}
+		sb.WriteString(":\n")
+		child.write(sb, indent+1)
+	}
+}
@@ -0,0 +1,118 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+var scaffoldOldDefaults = map[string]interface{}{
+	"image":    "octopusdeploy/agent",
+	"replicas": 1,
+	"agent": map[interface{}]interface{}{
+		"targetEnvironment": "Development",
+		"name":              "my-agent",
+		"labels":            map[interface{}]interface{}{"team": "octopus", "tier": "agent"},
+	},
+	"legacy": map[interface{}]interface{}{"enabled": false},
+}
+
+var scaffoldNewDefaults = map[string]interface{}{
+	"image":    map[interface{}]interface{}{"repository": "octopusdeploy/agent", "tag": ""},
+	"replicas": 1,
+	"agent": map[interface{}]interface{}{
+		"targetEnvironments": []interface{}{},
+	},
+	"deployment": map[interface{}]interface{}{
+		"name":   "my-agent",
+		"labels": map[interface{}]interface{}{"team": "octopus", "tier": "agent"},
+	},
+	"persistence": map[interface{}]interface{}{"size": "1Gi"},
+}
+
+func TestScaffold_MatchesMovedValues(t *testing.T) {
+	scaffold := ScaffoldMigration(scaffoldOldDefaults, scaffoldNewDefaults)
+
+	assert.Equal(t, []ScaffoldMove{
+		{From: "agent.labels", To: "deployment.labels", Reason: "every value in the map moved"},
+		{From: "agent.name", To: "deployment.name", Reason: "same default value and same key name"},
+		{From: "agent.targetEnvironment", To: "agent.targetEnvironments", Reason: "similar key name in the same map"},
+		{From: "image", To: "image.repository", Reason: "same default value"},
+	}, scaffold.Moves)
+	assert.Equal(t, []ValueChange{{Path: "legacy"}}, scaffold.Removed)
+	assert.Equal(t, []ValueChange{{Path: "image.tag", NewValue: ""}, {Path: "persistence"}}, scaffold.Added)
+}
+
+func TestScaffold_GeneratedMigrationsApply(t *testing.T) {
+	scaffold := ScaffoldMigration(scaffoldOldDefaults, scaffoldNewDefaults)
+
+	current := map[string]interface{}{
+		"image": "octopusdeploy/agent",
+		"agent": map[interface{}]interface{}{
+			"name":   "custom-agent",
+			"labels": map[interface{}]interface{}{"team": "platform"},
+		},
+		"legacy": map[interface{}]interface{}{"enabled": true},
+	}
+
+	expected := func(image interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"image":      image,
+			"agent":      map[string]interface{}{},
+			"deployment": map[string]interface{}{"name": "custom-agent", "labels": map[string]interface{}{"team": "platform"}},
+			"legacy":     map[string]interface{}{"enabled": true},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		format   MigrationFormat
+		content  string
+		expected map[string]interface{}
+	}{
+		{
+			name:    "operations",
+			format:  OperationsFormat,
+			content: scaffold.Operations("Generated from test defaults"),
+			// Operations cannot move a value into itself, so this is left as a TODO
+			expected: expected("octopusdeploy/agent"),
+		},
+		{
+			name:     "template",
+			format:   TemplateFormat,
+			content:  scaffold.Template("Generated from test defaults"),
+			expected: expected(map[string]interface{}{"repository": "octopusdeploy/agent"}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrated, err := applyMigration(current, &Migration{Format: tt.format, Content: tt.content}, nil, nil)
+			require.NoError(t, err, tt.content)
+			assert.Equal(t, tt.expected, NormalizeValues(migrated), tt.content)
+		})
+	}
+}
+
+func TestScaffold_Operations(t *testing.T) {
+	scaffold := Scaffold{
+		Moves: []ScaffoldMove{
+			{From: "agent.name", To: `deployment.app\.kubernetes\.io/name`, Reason: "same key name"},
+			{From: "image", To: "image.repository", Reason: "same default value"},
+		},
+		Removed: []ValueChange{{Path: "legacy", OldValue: true}},
+		Added:   []ValueChange{{Path: "replicas", NewValue: 1}},
+	}
+
+	assert.Equal(t, `# Generated by a test
+# agent.name -> deployment.app\.kubernetes\.io/name: same key name
+- op: move
+  from: agent.name
+  path: "deployment.app\\.kubernetes\\.io/name"
+# TODO: 'image' moved into 'image.repository' (same default value), which a move operation cannot do. Use a template migration instead.
+# TODO: 'legacy' was removed and no replacement was found. Migrate it, or remove it if it is no longer used:
+# - op: delete
+#   path: legacy
+# TODO: 'replicas' was added with the default 1. Set it if it should be derived from existing values.
+`, scaffold.Operations("Generated by a test"))
+}
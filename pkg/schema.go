@@ -0,0 +1,34 @@
+package pkg
+
+import (
+	"fmt"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// ValidateAgainstChartSchema validates the migrated values, coalesced with the chart's default values, against the
+// values.schema.json of the chart and its subcharts. The returned error lists every path that violates a schema.
+func ValidateAgainstChartSchema(chrt *chart.Chart, migratedValues map[string]interface{}) error {
+	values, err := chartutil.CoalesceValues(chrt, NormalizeValues(migratedValues))
+	if err != nil {
+		return fmt.Errorf("error coalescing migrated values with the chart's default values: %w", err)
+	}
+
+	if err = chartutil.ValidateAgainstSchema(chrt, values); err != nil {
+		return fmt.Errorf("migrated values don't meet the specifications of the schema(s) in the following chart(s):\n%w", err)
+	}
+
+	return nil
+}
+
+// ValidateAgainstChartSchemaFromPath loads the chart at the given path and validates the migrated values against its
+// values schema, see ValidateAgainstChartSchema.
+func ValidateAgainstChartSchemaFromPath(chartPath string, migratedValues map[string]interface{}) error {
+	chrt, err := loader.Load(chartPath)
+	if err != nil {
+		return fmt.Errorf("error loading chart: %w", err)
+	}
+
+	return ValidateAgainstChartSchema(chrt, migratedValues)
+}
@@ -0,0 +1,74 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const testValuesSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "required": ["agent"],
+  "properties": {
+    "agent": {
+      "type": "object",
+      "required": ["name"],
+      "properties": {
+        "name": {"type": "string"},
+        "target": {
+          "type": "object",
+          "properties": {
+            "environments": {"type": "array", "items": {"type": "string"}}
+          },
+          "additionalProperties": false
+        }
+      }
+    }
+  }
+}`
+
+func TestSchema_ValidValues(t *testing.T) {
+	migrated := map[string]interface{}{
+		"agent": map[interface{}]interface{}{
+			"target": map[interface{}]interface{}{
+				"environments": []interface{}{"test"},
+			},
+		},
+	}
+
+	chrt := testChart("my-chart", "2.0.0", nil)
+	chrt.Values = map[string]interface{}{"agent": map[string]interface{}{"name": "default-agent"}}
+	chrt.Schema = []byte(testValuesSchema)
+
+	// agent.name is required, but is provided by the chart's default values
+	assert.NoError(t, ValidateAgainstChartSchema(chrt, migrated))
+}
+
+func TestSchema_InvalidValues(t *testing.T) {
+	migrated := map[string]interface{}{
+		"agent": map[string]interface{}{
+			"name": 5,
+			"target": map[string]interface{}{
+				"environments":      "test",
+				"targetEnvironment": "test",
+			},
+		},
+	}
+
+	chrt := testChart("my-chart", "2.0.0", nil)
+	chrt.Schema = []byte(testValuesSchema)
+
+	err := ValidateAgainstChartSchema(chrt, migrated)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "my-chart:")
+	assert.ErrorContains(t, err, "- agent.name: Invalid type. Expected: string, given: integer")
+	assert.ErrorContains(t, err, "- agent.target.environments: Invalid type. Expected: array, given: string")
+	assert.ErrorContains(t, err, "- agent.target: Additional property targetEnvironment is not allowed")
+}
+
+func TestSchema_ChartWithoutSchema(t *testing.T) {
+	chrt := testChart("my-chart", "2.0.0", nil)
+
+	assert.NoError(t, ValidateAgainstChartSchema(chrt, map[string]interface{}{"anything": true}))
+}
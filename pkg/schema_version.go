@@ -0,0 +1,33 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// SchemaVersionAnnotation is the Chart.yaml annotation that declares the version of a chart's values schema, for
+// charts whose values do not change with every chart version.
+const SchemaVersionAnnotation = "helm-migrate-values/schema-version"
+
+// SchemaVersion returns the version of the chart's values schema, which determines the migrations that are applied to
+// its values. This is the chart's schema version annotation, or the chart's own version if it does not have one.
+func SchemaVersion(c *chart.Chart) (*semver.Version, error) {
+	if c.Metadata == nil {
+		return nil, fmt.Errorf("chart %s has no metadata", c.Name())
+	}
+
+	if annotation, ok := c.Metadata.Annotations[SchemaVersionAnnotation]; ok {
+		version, err := semver.NewVersion(annotation)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s annotation %s of chart %s: %w", SchemaVersionAnnotation, annotation, c.Name(), err)
+		}
+		return version, nil
+	}
+
+	version, err := semver.NewVersion(c.Metadata.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse version %s of chart %s: %w", c.Metadata.Version, c.Name(), err)
+	}
+	return version, nil
+}
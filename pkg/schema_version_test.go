@@ -0,0 +1,54 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	"testing"
+)
+
+func TestSchemaVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		metadata    *chart.Metadata
+		expected    string
+		expectedErr string
+	}{
+		{
+			name:     "chart version",
+			metadata: &chart.Metadata{Name: "my-chart", Version: "2.1.0"},
+			expected: "2.1.0",
+		},
+		{
+			name: "annotation",
+			metadata: &chart.Metadata{Name: "my-chart", Version: "3.0.0", Annotations: map[string]string{
+				SchemaVersionAnnotation: "2",
+			}},
+			expected: "2.0.0",
+		},
+		{
+			name: "invalid annotation",
+			metadata: &chart.Metadata{Name: "my-chart", Version: "3.0.0", Annotations: map[string]string{
+				SchemaVersionAnnotation: "two",
+			}},
+			expectedErr: "failed to parse helm-migrate-values/schema-version annotation two of chart my-chart",
+		},
+		{
+			name:        "invalid chart version",
+			metadata:    &chart.Metadata{Name: "my-chart", Version: "latest"},
+			expectedErr: "failed to parse version latest of chart my-chart",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, err := SchemaVersion(&chart.Chart{Metadata: tt.metadata})
+			if tt.expectedErr != "" {
+				require.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, version.String())
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SetFlag is a single --set, --set-string or --set-json argument of helm install or helm upgrade
+type SetFlag struct {
+	Flag       string
+	Assignment string
+}
+
+func (f SetFlag) String() string {
+	return f.Flag + " " + f.Assignment
+}
+
+// SetFlags converts the values to the --set arguments that produce the same values, for tools that cannot pass a
+// values file. Strings use --set-string, so they are never converted to another type, while numbers, booleans and
+// nulls use --set. Floats, empty lists and empty maps cannot be written with --set, so use --set-json. List items are
+// set one index at a time.
+func SetFlags(values map[string]interface{}) ([]SetFlag, error) {
+	var flags []SetFlag
+	var walk func(key string, value interface{}) error
+	walk = func(key string, value interface{}) error {
+		switch v := normalizeValue(value).(type) {
+		case map[string]interface{}:
+			if len(v) == 0 {
+				flags = append(flags, SetFlag{Flag: "--set-json", Assignment: key + "={}"})
+				return nil
+			}
+			for _, k := range sortedKeys(v) {
+				if err := walk(key+"."+escapeSetKey(k), v[k]); err != nil {
+					return err
+				}
+			}
+		case []interface{}:
+			if len(v) == 0 {
+				flags = append(flags, SetFlag{Flag: "--set-json", Assignment: key + "=[]"})
+				return nil
+			}
+			for i, item := range v {
+				if err := walk(fmt.Sprintf("%s[%d]", key, i), item); err != nil {
+					return err
+				}
+			}
+		case nil:
+			flags = append(flags, SetFlag{Flag: "--set", Assignment: key + "=null"})
+		case bool:
+			flags = append(flags, SetFlag{Flag: "--set", Assignment: key + "=" + strconv.FormatBool(v)})
+		case int, int64, uint64:
+			flags = append(flags, SetFlag{Flag: "--set", Assignment: fmt.Sprintf("%s=%d", key, v)})
+		case string:
+			flags = append(flags, SetFlag{Flag: "--set-string", Assignment: key + "=" + escapeSetValue(v)})
+		default:
+			data, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Errorf("value at %s cannot be converted to a --set argument: %w", key, err)
+			}
+			flags = append(flags, SetFlag{Flag: "--set-json", Assignment: key + "=" + string(data)})
+		}
+		return nil
+	}
+
+	for _, key := range sortedKeys(values) {
+		if err := walk(escapeSetKey(key), values[key]); err != nil {
+			return nil, err
+		}
+	}
+	return flags, nil
+}
+
+// escapeSetKey escapes the characters that separate keys, indexes and values in a --set argument
+func escapeSetKey(key string) string {
+	return strings.NewReplacer(`\`, `\\`, ".", `\.`, "=", `\=`, "[", `\[`, ",", `\,`).Replace(key)
+}
+
+// escapeSetValue escapes the characters that separate values, and a leading brace that would start a list
+func escapeSetValue(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, ",", `\,`).Replace(value)
+	if strings.HasPrefix(value, "{") {
+		value = `\` + value
+	}
+	return value
+}
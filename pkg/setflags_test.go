@@ -0,0 +1,55 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/strvals"
+	"testing"
+)
+
+func TestSetFlags(t *testing.T) {
+	values := map[string]interface{}{
+		"agent": map[string]interface{}{
+			"name":     "my-agent",
+			"replicas": 2,
+			"enabled":  true,
+			"ratio":    0.5,
+			"version":  "1.0",
+			"flag":     "true",
+			"tags":     "a,b",
+			"json":     "{not a list}",
+			"path":     `C:\agent`,
+		},
+		"annotations": map[string]interface{}{"example.com/name": "x=y"},
+		"environments": []interface{}{
+			"Development",
+			map[string]interface{}{"name": "Prod", "weight": 10},
+		},
+		"empty":    map[string]interface{}{},
+		"none":     []interface{}{},
+		"disabled": nil,
+	}
+
+	flags, err := SetFlags(values)
+	require.NoError(t, err)
+
+	assert.Contains(t, flags, SetFlag{Flag: "--set-string", Assignment: "agent.name=my-agent"})
+	assert.Contains(t, flags, SetFlag{Flag: "--set", Assignment: "agent.replicas=2"})
+	assert.Contains(t, flags, SetFlag{Flag: "--set-json", Assignment: "agent.ratio=0.5"})
+	assert.Contains(t, flags, SetFlag{Flag: "--set-string", Assignment: `annotations.example\.com/name=x=y`})
+	assert.Contains(t, flags, SetFlag{Flag: "--set-string", Assignment: "environments[1].name=Prod"})
+
+	// Helm parses the arguments back into the same values
+	parsed := map[string]interface{}{}
+	for _, f := range flags {
+		switch f.Flag {
+		case "--set":
+			require.NoError(t, strvals.ParseInto(f.Assignment, parsed), f.String())
+		case "--set-string":
+			require.NoError(t, strvals.ParseIntoString(f.Assignment, parsed), f.String())
+		case "--set-json":
+			require.NoError(t, strvals.ParseJSON(f.Assignment, parsed), f.String())
+		}
+	}
+	assert.True(t, valuesEqual(values, parsed), "expected %v, parsed %v", values, parsed)
+}
@@ -0,0 +1,251 @@
+package pkg
+
+import (
+	"fmt"
+	"helm.sh/helm/v3/pkg/chart"
+	"path"
+)
+
+// DefaultMigrationsDir is the directory, relative to a chart's root, containing the chart's migrations. Subcharts
+// always use this directory.
+const DefaultMigrationsDir = "value-migrations"
+
+// globalValuesKey is the key of the values that are shared by a chart and all of its subcharts
+const globalValuesKey = "global"
+
+// subchart is a dependency of a chart, with the key of its values within the chart's values
+type subchart struct {
+	Name string
+	Key  string
+}
+
+// MigrateSubcharts applies the migrations of each of the target chart's dependencies, and their dependencies in turn,
+// to the values under the dependency's name or alias. Each subchart is migrated from the schema version of the subchart
+// in the release's chart to the schema version in the target chart, using the migrations in the subchart's own value-migrations
+// directory. Subchart migrations can read and change the global values, as the subchart's templates would see them.
+//
+// If a dependency's alias was renamed between the charts, its values are moved to the new alias first. The result is
+// nil if no subchart migrations were applied.
+func MigrateSubcharts(values map[string]interface{}, fromChart *chart.Chart, toChart *chart.Chart, log Logger) (*MigrationResult, error) {
+	return NewMigrator(nil, log).MigrateSubcharts(values, fromChart, toChart)
+}
+
+// MigrateSubcharts migrates the values of the subcharts in the same way as the package level MigrateSubcharts
+// function, using the migrator's parameters and prompt. The migrator's provider is not used, as each subchart has its
+// own migrations.
+func (mg *Migrator) MigrateSubcharts(values map[string]interface{}, fromChart *chart.Chart, toChart *chart.Chart) (*MigrationResult, error) {
+	// The subchart migrators share the parameters, so that a prompted value is reused by every subchart
+	if mg.Params == nil {
+		mg.Params = make(map[string]interface{})
+	}
+
+	migrated, steps, err := mg.migrateSubcharts(normalizeMap(values), fromChart, toChart, "")
+	if err != nil || len(steps) == 0 {
+		return nil, err
+	}
+
+	return &MigrationResult{Values: migrated, Steps: steps}, nil
+}
+
+func (mg *Migrator) migrateSubcharts(values map[string]interface{}, fromChart *chart.Chart, toChart *chart.Chart, chartPath string) (map[string]interface{}, []MigrationStep, error) {
+	log := mg.Log
+	fromSubcharts, toSubcharts := subchartsOf(fromChart), subchartsOf(toChart)
+
+	var steps []MigrationStep
+	for _, sub := range toSubcharts {
+		fromSub, toSub := findDependency(fromChart, sub.Name), findDependency(toChart, sub.Name)
+		if fromSub == nil || toSub == nil {
+			log.Debug("subchart %s is not a dependency of both charts, skipping its migrations", sub.Name)
+			continue
+		}
+
+		if previousKey := renamedAlias(fromSubcharts, toSubcharts, sub); previousKey != "" {
+			if _, exists := values[sub.Key]; !exists && values[previousKey] != nil {
+				log.Debug("moving values of subchart %s from '%s' to its new alias '%s'", sub.Name, previousKey, sub.Key)
+				before := values
+				values = cloneMap(values)
+				values[sub.Key] = values[previousKey]
+				delete(values, previousKey)
+				steps = append(steps, MigrationStep{
+					Migration: &Migration{Name: fmt.Sprintf("rename alias of subchart %s from %s to %s", sub.Name, previousKey, sub.Key)},
+					Values:    values,
+					Changes:   DiffValues(before, values),
+				})
+			}
+		}
+
+		subValues, ok := values[sub.Key].(map[string]interface{})
+		if !ok || len(subValues) == 0 {
+			continue
+		}
+
+		subPath := path.Join(chartPath, "charts", sub.Name)
+		migratedSub, subSteps, err := mg.migrateSubchart(subValues, values[globalValuesKey], fromSub, toSub, subPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error migrating values of subchart %s: %w", sub.Key, err)
+		}
+
+		for _, step := range subSteps {
+			before := values
+			values = withSubchartValues(values, sub.Key, step.Values)
+			steps = append(steps, MigrationStep{Migration: step.Migration, Values: values, Changes: DiffValues(before, values)})
+		}
+		if len(subSteps) > 0 {
+			values = withSubchartValues(values, sub.Key, migratedSub)
+		}
+	}
+
+	return values, steps, nil
+}
+
+// migrateSubchart migrates the values of a single subchart, and of its own subcharts. The step values include the
+// global values, if the migration can see them.
+func (mg *Migrator) migrateSubchart(values map[string]interface{}, global interface{}, fromChart *chart.Chart, toChart *chart.Chart, chartPath string) (map[string]interface{}, []MigrationStep, error) {
+	log := mg.Log
+	// Like Helm, a subchart sees the parent's global values rather than any of its own
+	values = cloneMap(values)
+	if global != nil {
+		values[globalValuesKey] = global
+	}
+
+	var steps []MigrationStep
+	vFrom, errFrom := SchemaVersion(fromChart)
+	vTo, errTo := SchemaVersion(toChart)
+	if errFrom != nil || errTo != nil {
+		log.Warning("Cannot migrate values of subchart %s, as its schema version cannot be parsed", toChart.Name())
+	} else if !vFrom.Equal(vTo) {
+		// As for the chart itself, down migrations are defined by the newer chart
+		source := toChart
+		if vTo.LessThan(vFrom) {
+			source = fromChart
+		}
+
+		mp, err := NewChartFilesMigrationProvider(source.Files, DefaultMigrationsDir)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var result *MigrationResult
+		if len(mp.Migrations) > 0 {
+			log.Debug("migrating values of subchart %s from version %s to %s", toChart.Name(), vFrom, vTo)
+			if result, err = mg.subchartMigrator(mp, fromChart, toChart).Migrate(values, vFrom, vTo); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		if result != nil {
+			for _, step := range result.Steps {
+				m := *step.Migration
+				m.Name = path.Join(chartPath, DefaultMigrationsDir, m.Name)
+				steps = append(steps, MigrationStep{Migration: &m, Values: normalizeMap(step.Values), Changes: step.Changes})
+			}
+			values = normalizeMap(result.Values)
+		}
+	}
+
+	values, nestedSteps, err := mg.migrateSubcharts(values, fromChart, toChart, chartPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return values, append(steps, nestedSteps...), nil
+}
+
+// subchartMigrator returns a migrator for a subchart's migrations, with the same parameters and prompt. Migrations
+// using the full template context see the subchart versions as the charts.
+func (mg *Migrator) subchartMigrator(mp MigrationProvider, fromChart *chart.Chart, toChart *chart.Chart) *Migrator {
+	var env MigrationEnvironment
+	if mg.Environment != nil {
+		env = *mg.Environment
+	}
+	env.FromChart, env.ToChart = fromChart, toChart
+	return &Migrator{Provider: mp, Log: mg.Log, Params: mg.Params, Prompt: mg.Prompt, Environment: &env}
+}
+
+// withSubchartValues returns a copy of the values with the subchart's values replaced. Global values in the subchart's
+// values are moved to the parent's global values, as that is where the subchart reads them from.
+func withSubchartValues(values map[string]interface{}, key string, subValues map[string]interface{}) map[string]interface{} {
+	values = cloneMap(values)
+	subValues = cloneMap(subValues)
+
+	if global, ok := subValues[globalValuesKey]; ok {
+		delete(subValues, globalValuesKey)
+		if global == nil {
+			delete(values, globalValuesKey)
+		} else {
+			values[globalValuesKey] = global
+		}
+	}
+
+	values[key] = subValues
+	return values
+}
+
+// subchartsOf returns the chart's dependencies, including those in its charts directory that are not declared in its
+// Chart.yaml
+func subchartsOf(c *chart.Chart) []subchart {
+	var subcharts []subchart
+	declared := make(map[string]bool)
+	for _, dep := range c.Metadata.Dependencies {
+		key := dep.Name
+		if dep.Alias != "" {
+			key = dep.Alias
+		}
+		subcharts = append(subcharts, subchart{Name: dep.Name, Key: key})
+		declared[dep.Name] = true
+	}
+
+	for _, dep := range c.Dependencies() {
+		if !declared[dep.Name()] {
+			subcharts = append(subcharts, subchart{Name: dep.Name(), Key: dep.Name()})
+		}
+	}
+	return subcharts
+}
+
+func findDependency(c *chart.Chart, name string) *chart.Chart {
+	for _, dep := range c.Dependencies() {
+		if dep.Name() == name {
+			return dep
+		}
+	}
+	return nil
+}
+
+// renamedAlias returns the previous key of a subchart's values, if the subchart was the only instance of its chart in
+// both versions, and its alias changed.
+func renamedAlias(previous []subchart, current []subchart, sub subchart) string {
+	instances := 0
+	for _, c := range current {
+		if c.Name == sub.Name {
+			instances++
+		}
+	}
+	if instances != 1 {
+		return ""
+	}
+
+	var match *subchart
+	for i := range previous {
+		if previous[i].Name != sub.Name {
+			continue
+		}
+		if match != nil {
+			return ""
+		}
+		match = &previous[i]
+	}
+
+	if match == nil || match.Key == sub.Key {
+		return ""
+	}
+	return match.Key
+}
+
+func cloneMap(values map[string]interface{}) map[string]interface{} {
+	clone := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		clone[key] = value
+	}
+	return clone
+}
@@ -0,0 +1,147 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	"strings"
+	"testing"
+)
+
+// testChart returns a chart with the files, which are added to its templates if they are in the templates directory,
+// as when a chart is loaded
+func testChart(name string, version string, files map[string]string, dependencies ...*chart.Dependency) *chart.Chart {
+	c := &chart.Chart{Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: name, Version: version, Dependencies: dependencies}}
+	for fileName, content := range files {
+		file := &chart.File{Name: fileName, Data: []byte(content)}
+		if strings.HasPrefix(fileName, "templates/") {
+			c.Templates = append(c.Templates, file)
+		} else {
+			c.Files = append(c.Files, file)
+		}
+	}
+	return c
+}
+
+func TestMigrateSubcharts(t *testing.T) {
+	req := require.New(t)
+
+	fromChart := testChart("umbrella", "1.0.0", nil,
+		&chart.Dependency{Name: "database", Alias: "db"},
+		&chart.Dependency{Name: "agent"})
+	fromChart.AddDependency(
+		testChart("database", "1.0.0", nil),
+		testChart("agent", "3.0.0", nil))
+
+	toChart := testChart("umbrella", "2.0.0", nil,
+		&chart.Dependency{Name: "database", Alias: "postgres"},
+		&chart.Dependency{Name: "agent"})
+	database := testChart("database", "2.1.0", map[string]string{
+		"value-migrations/to-v2.ops.yaml": "- op: move\n  from: user\n  path: auth.username\n",
+		"value-migrations/to-v3.ops.yaml": "- op: delete\n  path: auth\n",
+	})
+	agent := testChart("agent", "4.0.0", map[string]string{
+		"value-migrations/to-v4.yaml": "# migration-mode: merge\nglobal:\n  environment: {{ .targetEnvironment | quote }}\ntargetEnvironment: null\n",
+	})
+	toChart.AddDependency(database, agent)
+
+	values := map[string]interface{}{
+		"replicas": 2,
+		"db":       map[interface{}]interface{}{"user": "admin"},
+		"agent":    map[interface{}]interface{}{"targetEnvironment": "Production", "name": "my-agent"},
+		"global":   map[interface{}]interface{}{"region": "eu"},
+	}
+
+	result, err := MigrateSubcharts(values, fromChart, toChart, *NewLogger(false))
+	req.NoError(err)
+	req.NotNil(result)
+
+	assert.Equal(t, map[string]interface{}{
+		"replicas": 2,
+		"postgres": map[string]interface{}{"auth": map[string]interface{}{"username": "admin"}},
+		"agent":    map[string]interface{}{"name": "my-agent"},
+		"global":   map[string]interface{}{"region": "eu", "environment": "Production"},
+	}, NormalizeValues(result.Values))
+
+	req.Len(result.Steps, 3)
+	assert.Equal(t, "rename alias of subchart database from db to postgres", result.Steps[0].Migration.Name)
+	assert.Equal(t, []ValueMove{{From: "db.user", To: "postgres.user", Value: "admin"}}, result.Steps[0].Changes.Moved)
+	assert.Equal(t, "charts/database/value-migrations/to-v2.ops.yaml", result.Steps[1].Migration.Name)
+	assert.Equal(t, []ValueMove{{From: "postgres.user", To: "postgres.auth.username", Value: "admin"}}, result.Steps[1].Changes.Moved)
+	assert.Equal(t, "charts/agent/value-migrations/to-v4.yaml", result.Steps[2].Migration.Name)
+	assert.ElementsMatch(t, []string{"agent.targetEnvironment", "global.environment"}, result.Steps[2].Changes.Paths())
+}
+
+func TestMigrateSubcharts_NestedAndDowngrade(t *testing.T) {
+	req := require.New(t)
+
+	nestedMigrations := map[string]string{
+		"value-migrations/to-v2.ops.yaml":   "- op: renameKey\n  path: host\n  to: hostname\n",
+		"value-migrations/from-v2.ops.yaml": "- op: renameKey\n  path: hostname\n  to: host\n",
+	}
+
+	newChart := testChart("umbrella", "2.0.0", nil)
+	newBackend := testChart("backend", "1.0.0", nil)
+	newBackend.AddDependency(testChart("cache", "2.0.0", nestedMigrations))
+	newChart.AddDependency(newBackend)
+
+	oldChart := testChart("umbrella", "1.0.0", nil)
+	oldBackend := testChart("backend", "1.0.0", nil)
+	oldBackend.AddDependency(testChart("cache", "1.0.0", nil))
+	oldChart.AddDependency(oldBackend)
+
+	upgraded, err := MigrateSubcharts(map[string]interface{}{
+		"backend": map[string]interface{}{"cache": map[string]interface{}{"host": "redis"}},
+	}, oldChart, newChart, *NewLogger(false))
+	req.NoError(err)
+	assert.Equal(t, map[string]interface{}{
+		"backend": map[string]interface{}{"cache": map[string]interface{}{"hostname": "redis"}},
+	}, upgraded.Values)
+
+	// Down migrations are read from the newer chart, which is the release's chart when downgrading
+	downgraded, err := MigrateSubcharts(upgraded.Values, newChart, oldChart, *NewLogger(false))
+	req.NoError(err)
+	assert.Equal(t, map[string]interface{}{
+		"backend": map[string]interface{}{"cache": map[string]interface{}{"host": "redis"}},
+	}, downgraded.Values)
+}
+
+func TestMigrateSubcharts_NoMigrations(t *testing.T) {
+	fromChart := testChart("umbrella", "1.0.0", nil)
+	fromChart.AddDependency(testChart("database", "1.0.0", nil))
+	toChart := testChart("umbrella", "2.0.0", nil)
+	toChart.AddDependency(testChart("database", "2.0.0", nil))
+
+	result, err := MigrateSubcharts(map[string]interface{}{"database": map[string]interface{}{"user": "admin"}}, fromChart, toChart, *NewLogger(false))
+	require.NoError(t, err)
+	assert.Nil(t, result)
+}
+
+func TestMigrateSubcharts_SchemaVersionAnnotation(t *testing.T) {
+	req := require.New(t)
+
+	// The subchart's major version was bumped without changing its values, so its to-v2 migration does not apply
+	fromDatabase := testChart("database", "1.0.0", nil)
+	fromDatabase.Metadata.Annotations = map[string]string{SchemaVersionAnnotation: "1"}
+	toDatabase := testChart("database", "2.0.0", map[string]string{
+		"value-migrations/to-v2.ops.yaml": "- op: move\n  from: user\n  path: auth.username\n",
+	})
+	toDatabase.Metadata.Annotations = map[string]string{SchemaVersionAnnotation: "1"}
+
+	fromChart := testChart("umbrella", "1.0.0", nil, &chart.Dependency{Name: "database"})
+	fromChart.AddDependency(fromDatabase)
+	toChart := testChart("umbrella", "2.0.0", nil, &chart.Dependency{Name: "database"})
+	toChart.AddDependency(toDatabase)
+
+	values := map[string]interface{}{"database": map[string]interface{}{"user": "admin"}}
+	result, err := MigrateSubcharts(values, fromChart, toChart, *NewLogger(false))
+	req.NoError(err)
+	req.Nil(result)
+
+	// Once the schema version changes, the migration applies
+	toDatabase.Metadata.Annotations[SchemaVersionAnnotation] = "2"
+	result, err = MigrateSubcharts(values, fromChart, toChart, *NewLogger(false))
+	req.NoError(err)
+	req.NotNil(result)
+	req.Equal(map[string]interface{}{"database": map[string]interface{}{"auth": map[string]interface{}{"username": "admin"}}}, result.Values)
+}
@@ -0,0 +1,40 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+)
+
+// The headers helm get values prints before the user-supplied values, or with --all, the computed values
+var helmGetValuesHeaders = []string{"USER-SUPPLIED VALUES:", "COMPUTED VALUES:"}
+
+// ReadValues reads a YAML or JSON values file, such as one captured with helm get values, whose header is ignored. An
+// empty file, or one with only null values, has no values.
+func ReadValues(r io.Reader) (map[string]interface{}, error) {
+	doc, err := ReadValuesDocument(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.Values()
+}
+
+func trimHelmGetValuesHeader(data []byte) []byte {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		for _, header := range helmGetValuesHeaders {
+			if line == header {
+				idx := bytes.Index(data, []byte(header))
+				return data[idx+len(header):]
+			}
+		}
+		break
+	}
+	return data
+}
@@ -0,0 +1,60 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestReadValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected map[string]interface{}
+	}{
+		{
+			name:     "values file",
+			input:    "agent:\n  name: my-agent\n",
+			expected: map[string]interface{}{"agent": map[string]interface{}{"name": "my-agent"}},
+		},
+		{
+			name:     "helm get values output",
+			input:    "USER-SUPPLIED VALUES:\nagent:\n  name: my-agent\n",
+			expected: map[string]interface{}{"agent": map[string]interface{}{"name": "my-agent"}},
+		},
+		{
+			name:     "helm get values --all output",
+			input:    "\nCOMPUTED VALUES:\nreplicas: 1\n",
+			expected: map[string]interface{}{"replicas": 1},
+		},
+		{
+			name:     "helm get values -o json output",
+			input:    `{"agent":{"name":"my-agent"}}`,
+			expected: map[string]interface{}{"agent": map[string]interface{}{"name": "my-agent"}},
+		},
+		{
+			name:     "release without values",
+			input:    "USER-SUPPLIED VALUES:\nnull\n",
+			expected: nil,
+		},
+		{
+			name:     "empty",
+			input:    "",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := ReadValues(strings.NewReader(tt.input))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, values)
+		})
+	}
+}
+
+func TestReadValues_Invalid(t *testing.T) {
+	_, err := ReadValues(strings.NewReader("- a list\n"))
+	require.ErrorContains(t, err, "error parsing values")
+}